@@ -0,0 +1,92 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+// Backend is implemented by the driver that actually talks to the scanner
+// hardware (or to a remote saned). The package level operations mirror the
+// SANE C API and dispatch to the Backend installed with SetBackend.
+//
+// Methods may be called concurrently for different handles, as gosane lets
+// several devices scan in parallel, and Cancel may be called concurrently
+// with any method on the same handle. Implementations must allow this.
+type Backend interface {
+	// Init initializes the backend and returns the version code of the
+	// SANE API it implements. It is called once, before any other method.
+	Init(authorize AuthorizationCallback) (SInt, error)
+
+	// Exit releases all resources held by the backend. No other method is
+	// called after Exit until Init is called again.
+	Exit()
+
+	// GetDevices returns the devices available through the backend. If
+	// localOnly is true, only locally attached devices are returned.
+	GetDevices(localOnly bool) ([]Device, error)
+
+	// Open establishes a connection to the named device.
+	Open(name SStringConst) (SHandle, error)
+
+	// Close terminates the association between h and the device it
+	// represents.
+	Close(h SHandle)
+
+	// GetOptionDescriptor returns the descriptor of option n of h, or nil
+	// if there is no such option.
+	GetOptionDescriptor(h SHandle, n SInt) *OptionDescriptor
+
+	// ControlOption gets or sets the value of option n of h. See the
+	// package level ControlOption for the value representation.
+	ControlOption(h SHandle, n SInt, a Action, v interface{}) (Info, error)
+
+	// GetParameters returns the scan parameters of h.
+	GetParameters(h SHandle) (*Parameters, error)
+
+	// Start initiates acquisition of a frame from h.
+	Start(h SHandle) error
+
+	// Read reads up to len(buf) bytes of image data from h. Eof is returned
+	// once the current frame has been read entirely.
+	Read(h SHandle, buf []byte) (int, error)
+
+	// Cancel cancels the currently pending operation of h. It may be
+	// called from another goroutine while Read is blocked.
+	Cancel(h SHandle)
+
+	// SetIOMode selects blocking or non-blocking reads for h.
+	SetIOMode(h SHandle, nonBlocking bool) error
+
+	// GetSelectFd returns a file descriptor that becomes readable when
+	// image data is available from h.
+	GetSelectFd(h SHandle) (int, error)
+}
+
+// DescriptorLister may be implemented by a Backend that can return all the
+// option descriptors of a handle at once, such as one talking to a remote
+// saned, whose protocol fetches them in a single round trip
+// (SANE_NET_GET_OPTION_DESCRIPTORS). GetOptionDescriptors uses it when
+// available.
+type DescriptorLister interface {
+	// GetOptionDescriptors returns the descriptors of all options of h,
+	// indexed by option number.
+	GetOptionDescriptors(h SHandle) ([]*OptionDescriptor, error)
+}
+
+// ValueGetter may be implemented by a Backend that can read the values of
+// several options at once, such as one talking to a remote saned, which can
+// pipeline its SANE_NET_CONTROL_OPTION requests rather than wait for each
+// reply in turn. OptionValues uses it when available.
+type ValueGetter interface {
+	// GetOptionValues reads the value of option ns[i] of h into bufs[i],
+	// a buffer as passed to ControlOption with ActionGetValue.
+	GetOptionValues(h SHandle, ns []SInt, bufs []interface{}) error
+}
+
+var backend Backend
+
+// SetBackend installs b as the Backend used by the package level operations.
+// It must be called before Init, and not while any operation is in
+// progress.
+func SetBackend(b Backend) {
+	backend = b
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"sync"
+	"unicode/utf8"
+)
+
+var (
+	decoderMu     sync.RWMutex
+	stringDecoder func([]byte) string
+)
+
+// SetStringDecoder installs f to decode the human readable strings returned
+// by GetDevices (Vendor, Model, DeviceType, BackendAuthorEmail,
+// DeviceLocation and Comment) and GetOptionDescriptor (Title and Desc).
+// SANE strings are byte arrays with no encoding guarantee, so by default
+// valid UTF-8 is kept as is and anything else is decoded as Latin-1, which
+// some backends emit. Passing nil restores the default.
+//
+// Device and option names, string list constraints and option values are
+// never decoded, as they must be passed back to the backend unchanged.
+func SetStringDecoder(f func([]byte) string) {
+	decoderMu.Lock()
+	stringDecoder = f
+	decoderMu.Unlock()
+}
+
+// decodeLatin1Fallback returns b as a string if it is valid UTF-8, and
+// decodes it as Latin-1 otherwise.
+func decodeLatin1Fallback(b []byte) string {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+// decodeString decodes s with the installed string decoder.
+func decodeString(s SStringConst) SStringConst {
+	decoderMu.RLock()
+	f := stringDecoder
+	decoderMu.RUnlock()
+	if f == nil {
+		f = decodeLatin1Fallback
+	}
+	return SStringConst(f([]byte(s)))
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"strings"
+	"testing"
+)
+
+// modelFake returns a fakeBackend whose device has the given model.
+func modelFake(model SStringConst) *fakeBackend {
+	f := newFakeBackend()
+	f.devices[0].Model = model
+	return f
+}
+
+func TestDecodeLatin1Model(t *testing.T) {
+	for _, c := range []struct {
+		model SStringConst
+		want  string
+	}{
+		{"Num\xe9riseur", "Numériseur"}, // Latin-1
+		{"Numériseur", "Numériseur"},    // UTF-8
+	} {
+		SetBackend(modelFake(c.model))
+		Init(0, nil)
+		devs, err := GetDevices(false)
+		Exit()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(devs[0].Model); got != c.want {
+			t.Errorf("model %q decoded as %q, want %q", c.model, got, c.want)
+		}
+	}
+}
+
+func TestSetStringDecoder(t *testing.T) {
+	SetStringDecoder(func(b []byte) string { return strings.ToUpper(string(b)) })
+	defer SetStringDecoder(nil)
+	SetBackend(modelFake("flatbed"))
+	Init(0, nil)
+	defer Exit()
+	devs, err := GetDevices(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if devs[0].Model != "FLATBED" || devs[0].Name != "fake:0" {
+		t.Errorf("decoded device %q model %q, want the model decoded only", devs[0].Name, devs[0].Model)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// modeDepthRe matches the bit count in scan modes such as "48bit Color".
+var modeDepthRe = regexp.MustCompile(`(?i)(\d+)\s*-?\s*bits?`)
+
+// modeDepth returns the per-sample depth encoded in scan mode v, and v with
+// the depth removed, e.g. 16 and "color" for "48bit Color". depth is 0 if v
+// does not encode a depth.
+func modeDepth(v string) (depth int, kind string) {
+	m := modeDepthRe.FindStringSubmatchIndex(v)
+	if m == nil {
+		return 0, strings.ToLower(strings.TrimSpace(v))
+	}
+	depth, _ = strconv.Atoi(v[m[2]:m[3]])
+	if depth > 16 {
+		// The bit count is per pixel of an RGB mode.
+		depth /= 3
+	}
+	return depth, strings.ToLower(strings.TrimSpace(v[:m[0]] + v[m[1]:]))
+}
+
+// SetMaxDepth selects the highest sample depth h supports and returns it.
+// The depth is taken from the "depth" (or "bit-depth") option when the
+// device has one. Otherwise, for devices that encode the depth in their scan
+// modes (e.g. "24bit Color" and "48bit Color"), the deepest mode of the same
+// kind as the current one is selected. Unsupported is returned if the depth
+// cannot be selected.
+func SetMaxDepth(h SHandle) (int, error) {
+	for _, name := range []SStringConst{NameBitDepth, NameBitDepthAlt} {
+		_, d, err := FindOption(h, name)
+		if err == Unsupported {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		max, ok := 0.0, false
+		if words := d.WordList(); words != nil {
+			for _, w := range words {
+				if v := wordToFloat(d.Type, w); !ok || v > max {
+					max, ok = v, true
+				}
+			}
+		} else {
+			_, max, _, ok = d.RangeInfo()
+		}
+		if !ok {
+			return 0, Unsupported
+		}
+		v, _, err := setFloatOption(h, name, max)
+		return int(v), err
+	}
+
+	mode, err := getStringOption(h, NameScanMode)
+	if err != nil {
+		return 0, err
+	}
+	_, kind := modeDepth(mode)
+	_, d, err := FindOption(h, NameScanMode)
+	if err != nil {
+		return 0, err
+	}
+	best, bestDepth := "", 0
+	for _, v := range d.StringList() {
+		if depth, k := modeDepth(string(v)); k == kind && depth > bestDepth {
+			best, bestDepth = string(v), depth
+		}
+	}
+	if bestDepth == 0 {
+		return 0, Unsupported
+	}
+	if _, err := setStringOption(h, NameScanMode, best); err != nil {
+		return 0, err
+	}
+	return bestDepth, nil
+}
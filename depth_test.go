@@ -0,0 +1,47 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import "testing"
+
+func TestSetMaxDepth(t *testing.T) {
+	f := newFakeBackend()
+	f.addOption(OptionDescriptor{Name: NameBitDepth, Type: TypeInt, Size: 4, Cap: SoftSelect | SoftDetect,
+		Constraint: WordListConstraint{8, 16, 1}}, 8)
+	h := setupFake(t, f)
+	if depth, err := SetMaxDepth(h); depth != 16 || err != nil {
+		t.Errorf("SetMaxDepth = %d, %v; want 16", depth, err)
+	}
+	if v := f.option(NameBitDepth).words[0]; v != 16 {
+		t.Errorf("depth option set to %d, want 16", v)
+	}
+	Exit()
+
+	f = newFakeBackend()
+	f.addOption(OptionDescriptor{Name: NameBitDepthAlt, Type: TypeInt, Size: 4, Cap: SoftSelect | SoftDetect,
+		Constraint: RangeConstraint{SRange{Min: 8, Max: 12, Quant: 2}}}, 8)
+	h = setupFake(t, f)
+	if depth, err := SetMaxDepth(h); depth != 12 || err != nil {
+		t.Errorf("SetMaxDepth with a range = %d, %v; want 12", depth, err)
+	}
+	Exit()
+
+	// Devices encoding the depth in their modes keep the kind of mode.
+	f = newFakeBackend()
+	mode := f.option(NameScanMode)
+	mode.desc.Constraint = StringListConstraint{"8bit Gray", "16bit Gray", "24bit Color", "48bit Color"}
+	mode.str = "24bit Color"
+	h = setupFake(t, f)
+	defer Exit()
+	if depth, err := SetMaxDepth(h); depth != 16 || err != nil || mode.str != "48bit Color" {
+		t.Errorf("SetMaxDepth by mode = %d, %v, mode %q; want 16 and 48bit Color", depth, err, mode.str)
+	}
+
+	mode.desc.Constraint = StringListConstraint{"Color", "Gray"}
+	mode.str = "Color"
+	if _, err := SetMaxDepth(h); err != Unsupported {
+		t.Errorf("SetMaxDepth without depths = %v, want Unsupported", err)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"sync"
+	"time"
+)
+
+// deviceCache holds the last result of Backend.GetDevices for each value of
+// localOnly.
+type deviceCache struct {
+	devs    []Device
+	fetched time.Time
+}
+
+var (
+	deviceCacheMu  sync.Mutex
+	deviceCacheTTL time.Duration
+	deviceCaches   = make(map[bool]deviceCache)
+)
+
+// SetDeviceCacheTTL makes GetDevices reuse its last result for d, instead
+// of probing the backend again, which can be slow. This helps GUIs that
+// refresh their device list often. A d of 0, the default, disables the
+// cache. GetDevicesForceRefresh always probes the backend.
+func SetDeviceCacheTTL(d time.Duration) {
+	deviceCacheMu.Lock()
+	defer deviceCacheMu.Unlock()
+	deviceCacheTTL = d
+	if d == 0 {
+		deviceCaches = make(map[bool]deviceCache)
+	}
+}
+
+// cachedDevices returns the cached devices for localOnly, if any are still
+// fresh.
+func cachedDevices(localOnly bool) ([]Device, bool) {
+	deviceCacheMu.Lock()
+	defer deviceCacheMu.Unlock()
+	c, ok := deviceCaches[localOnly]
+	if !ok || time.Since(c.fetched) >= deviceCacheTTL {
+		return nil, false
+	}
+	return c.devs, true
+}
+
+// cacheDevices stores devs as the devices for localOnly, if the cache is
+// enabled.
+func cacheDevices(localOnly bool, devs []Device) {
+	deviceCacheMu.Lock()
+	defer deviceCacheMu.Unlock()
+	if deviceCacheTTL > 0 {
+		deviceCaches[localOnly] = deviceCache{devs: devs, fetched: time.Now()}
+	}
+}
+
+// flushDeviceCache empties the cache, e.g. when the backend is released.
+func flushDeviceCache() {
+	deviceCacheMu.Lock()
+	defer deviceCacheMu.Unlock()
+	deviceCaches = make(map[bool]deviceCache)
+}
@@ -0,0 +1,140 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"strings"
+)
+
+// FindDevices returns the devices returned by GetDevices for which filter
+// returns true. A nil filter matches every device.
+func FindDevices(localOnly bool, filter func(Device) bool) ([]Device, error) {
+	devs, err := GetDevices(localOnly)
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		return devs, nil
+	}
+	var found []Device
+	for _, d := range devs {
+		if filter(d) {
+			found = append(found, d)
+		}
+	}
+	return found, nil
+}
+
+// ByVendor returns a FindDevices filter matching devices whose Vendor is
+// vendor, ignoring case.
+func ByVendor(vendor string) func(Device) bool {
+	return func(d Device) bool {
+		return strings.EqualFold(string(d.Vendor), vendor)
+	}
+}
+
+// ByType returns a FindDevices filter matching devices whose DeviceType is
+// typ (e.g. "flatbed scanner"), ignoring case.
+func ByType(typ SStringConst) func(Device) bool {
+	return func(d Device) bool {
+		return strings.EqualFold(string(d.DeviceType), string(typ))
+	}
+}
+
+// MatchAll returns a FindDevices filter matching devices matched by all of
+// filters.
+func MatchAll(filters ...func(Device) bool) func(Device) bool {
+	return func(d Device) bool {
+		for _, f := range filters {
+			if !f(d) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// deviceBackend returns the backend part of a device name of the form
+// "backend:device".
+func deviceBackend(name SStringConst) string {
+	s := string(name)
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// OpenWithBackend opens device through the named backend by composing the
+// device name "backend:device", e.g. to go through the "net" backend
+// explicitly.
+func OpenWithBackend(backend, device string) (SHandle, error) {
+	return Open(SStringConst(backend + ":" + device))
+}
+
+// OpenName returns the exact name to pass to Open to open d, which is
+// d.Name unchanged: names returned by GetDevices are already qualified with
+// the backend providing the device, as in "backend:device". Devices of a
+// remote saned, reached through the "net" backend, are additionally wrapped
+// as "net:host:backend:device", where host is in brackets if it is an IPv6
+// address (see NetDeviceName); no further wrapping must be applied.
+func (d Device) OpenName() SStringConst {
+	return d.Name
+}
+
+// NetDeviceName wraps the device name name, as known to the saned running
+// on host, into the name under which the "net" backend exposes it.
+func NetDeviceName(host string, name SStringConst) SStringConst {
+	if strings.IndexByte(host, ':') >= 0 && !strings.HasPrefix(host, "[") {
+		host = "[" + host + "]"
+	}
+	return SStringConst("net:" + host + ":" + string(name))
+}
+
+// Backends returns the names of the backends that provide at least one of
+// the devices returned by GetDevices, in order of first appearance.
+func Backends() ([]string, error) {
+	devs, err := GetDevices(false)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var backends []string
+	for _, d := range devs {
+		b := deviceBackend(d.Name)
+		if !seen[b] {
+			seen[b] = true
+			backends = append(backends, b)
+		}
+	}
+	return backends, nil
+}
+
+// normalizeDeviceName strips the parts of a device name that change when a
+// device is reconnected, such as the USB bus and device numbers in
+// "epson2:libusb:001:005".
+func normalizeDeviceName(name SStringConst) string {
+	parts := strings.Split(string(name), ":")
+	kept := parts[:0]
+	for _, p := range parts {
+		if strings.Trim(p, "0123456789") != "" {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, ":")
+}
+
+// SameDevice reports whether a and b are likely the same physical device,
+// e.g. to match a reconnected scanner with a remembered one although its
+// name changed. It compares the vendor and model, ignoring case, and the
+// device names with bus addresses removed. This is a heuristic: two
+// identical scanners attached through the same backend are not told apart.
+func SameDevice(a, b Device) bool {
+	if a.Name == b.Name {
+		return true
+	}
+	return strings.EqualFold(strings.TrimSpace(string(a.Vendor)), strings.TrimSpace(string(b.Vendor))) &&
+		strings.EqualFold(strings.TrimSpace(string(a.Model)), strings.TrimSpace(string(b.Model))) &&
+		normalizeDeviceName(a.Name) == normalizeDeviceName(b.Name)
+}
@@ -0,0 +1,218 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// deviceFake returns a fakeBackend listing a few devices.
+func deviceFake() *fakeBackend {
+	f := newFakeBackend()
+	f.devices = []Device{
+		{Name: "epson2:libusb:001:005", Vendor: "Epson", Model: "GT-S650", DeviceType: "flatbed scanner"},
+		{Name: "fujitsu:fi-7160:1", Vendor: "FUJITSU", Model: "fi-7160", DeviceType: "sheetfed scanner"},
+		{Name: "epson2:net:10.0.0.9", Vendor: "Epson", Model: "DS-530", DeviceType: "sheetfed scanner"},
+		{Name: "v4l:/dev/video0", Vendor: "Noname", Model: "Webcam", DeviceType: "virtual device"},
+	}
+	return f
+}
+
+// deviceNames returns the names of devs.
+func deviceNames(devs []Device) []SStringConst {
+	var names []SStringConst
+	for _, d := range devs {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+func TestFindDevices(t *testing.T) {
+	SetBackend(deviceFake())
+	Init(0, nil)
+	defer Exit()
+
+	for _, c := range []struct {
+		name   string
+		filter func(Device) bool
+		want   []SStringConst
+	}{
+		{"all", nil, []SStringConst{"epson2:libusb:001:005", "fujitsu:fi-7160:1", "epson2:net:10.0.0.9", "v4l:/dev/video0"}},
+		{"vendor", ByVendor("epson"), []SStringConst{"epson2:libusb:001:005", "epson2:net:10.0.0.9"}},
+		{"type", ByType("Sheetfed Scanner"), []SStringConst{"fujitsu:fi-7160:1", "epson2:net:10.0.0.9"}},
+		{"vendor and type", MatchAll(ByVendor("EPSON"), ByType("sheetfed scanner")), []SStringConst{"epson2:net:10.0.0.9"}},
+		{"disjoint", MatchAll(ByVendor("Fujitsu"), ByType("flatbed scanner")), nil},
+	} {
+		devs, err := FindDevices(false, c.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := deviceNames(devs); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: found %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+// nameFake is a fakeBackend recording the names it opens.
+type nameFake struct {
+	*fakeBackend
+	opened *[]SStringConst
+}
+
+func (f nameFake) Open(name SStringConst) (SHandle, error) {
+	*f.opened = append(*f.opened, name)
+	return f.fakeBackend.Open(name)
+}
+
+func TestOpenWithBackend(t *testing.T) {
+	var opened []SStringConst
+	SetBackend(nameFake{deviceFake(), &opened})
+	Init(0, nil)
+	defer Exit()
+
+	if _, err := OpenWithBackend("net", "scanhost:epson2:libusb:001:005"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []SStringConst{"net:scanhost:epson2:libusb:001:005"}; !reflect.DeepEqual(opened, want) {
+		t.Errorf("opened %q, want %q", opened, want)
+	}
+
+	for name, want := range map[SStringConst]string{
+		"epson2:libusb:001:005": "epson2",
+		"v4l:/dev/video0":       "v4l",
+		"test":                  "test",
+	} {
+		if got := deviceBackend(name); got != want {
+			t.Errorf("deviceBackend(%q) = %q, want %q", name, got, want)
+		}
+	}
+
+	backends, err := Backends()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"epson2", "fujitsu", "v4l"}; !reflect.DeepEqual(backends, want) {
+		t.Errorf("Backends = %q, want %q", backends, want)
+	}
+}
+
+func TestSameDevice(t *testing.T) {
+	f := deviceFake()
+	SetBackend(f)
+	Init(0, nil)
+	defer Exit()
+
+	before, err := GetDevices(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The GT-S650 is replugged into another port.
+	f.devices[0].Name = "epson2:libusb:003:012"
+	after, err := GetDevices(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range before {
+		if !SameDevice(before[i], after[i]) {
+			t.Errorf("%s and %s not matched", before[i].Name, after[i].Name)
+		}
+		for j := range after {
+			if i != j && SameDevice(before[i], after[j]) {
+				t.Errorf("%s matched %s", before[i].Name, after[j].Name)
+			}
+		}
+	}
+
+	other := before[0]
+	other.Name, other.Model = "epson2:libusb:001:006", "GT-S55"
+	if SameDevice(before[0], other) {
+		t.Error("devices of different models matched")
+	}
+}
+
+func TestDeviceCache(t *testing.T) {
+	f := deviceFake()
+	SetBackend(f)
+	Init(0, nil)
+	defer Exit()
+	probes := func() int { return countCalls(f, "GetDevices") }
+
+	// Off by default.
+	GetDevices(false)
+	GetDevices(false)
+	if n := probes(); n != 2 {
+		t.Fatalf("probed %d times without a cache, want 2", n)
+	}
+
+	SetDeviceCacheTTL(time.Hour)
+	defer SetDeviceCacheTTL(0)
+	first, _ := GetDevices(false)
+	second, err := GetDevices(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := probes(); n != 3 {
+		t.Errorf("probed %d times for two calls within the TTL, want once", n-2)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("cached devices %v, want %v", second, first)
+	}
+	GetDevices(true)
+	if n := probes(); n != 4 {
+		t.Error("local devices served from the cache of all devices")
+	}
+	f.devices = f.devices[:1]
+	if devs, _ := GetDevicesForceRefresh(false); len(devs) != 1 || probes() != 5 {
+		t.Errorf("GetDevicesForceRefresh returned %d devices after %d probes", len(devs), probes())
+	}
+	if devs, _ := GetDevices(false); len(devs) != 1 || probes() != 5 {
+		t.Error("forced refresh not cached")
+	}
+
+	SetDeviceCacheTTL(10 * time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	GetDevices(false)
+	if n := probes(); n != 6 {
+		t.Errorf("probed %d times after the TTL expired, want 6", n)
+	}
+}
+
+func TestOpenName(t *testing.T) {
+	var opened []SStringConst
+	f := deviceFake()
+	f.devices = append(f.devices,
+		Device{Name: NetDeviceName("scanhost", "epson2:libusb:001:005"), Vendor: "Epson", Model: "GT-S650"},
+		Device{Name: NetDeviceName("fe80::1", "fujitsu:fi-7160:1"), Vendor: "FUJITSU", Model: "fi-7160"},
+	)
+	SetBackend(nameFake{f, &opened})
+	Init(0, nil)
+	defer Exit()
+
+	devs, err := GetDevices(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range devs {
+		if _, err := Open(d.OpenName()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []SStringConst{
+		"epson2:libusb:001:005", "fujitsu:fi-7160:1", "epson2:net:10.0.0.9", "v4l:/dev/video0",
+		"net:scanhost:epson2:libusb:001:005", "net:[fe80::1]:fujitsu:fi-7160:1",
+	}
+	if !reflect.DeepEqual(opened, want) {
+		t.Errorf("opened %q, want %q", opened, want)
+	}
+	if n := NetDeviceName("[fe80::1]", "test:0"); n != "net:[fe80::1]:test:0" {
+		t.Errorf("bracketed IPv6 host wrapped as %q", n)
+	}
+	// The net backend's names parse back into their parts.
+	if backend, host, _ := ParseAuthResource(want[5]); backend != "fujitsu" || host != "fe80::1" {
+		t.Errorf("%q parsed as backend %q on host %q", want[5], backend, host)
+	}
+}
@@ -0,0 +1,16 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+// Package gosane is a pure Go implementation of the SANE (Scanner Access Now
+// Easy) API. The package level operations mirror the SANE C API and
+// dispatch to the Backend installed with SetBackend; higher level helpers
+// such as ScanImage and ScanDocument are built on top of them.
+//
+// A single handle must not be used from several goroutines at once, except
+// that Cancel may be called while another goroutine is blocked in Read on
+// the same handle. Different handles, e.g. of two devices, may scan in
+// parallel from different goroutines: the state gosane keeps for each
+// handle and its package level settings (SetLogger, SetTranslator,
+// SetMetricsSink and the like) are safe for concurrent use.
+package gosane
@@ -0,0 +1,169 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"bytes"
+	"image"
+	"strings"
+)
+
+// ScanAllPages scans pages from h until the document feeder runs out of
+// paper, and returns them in order. NoDocs is returned if the feeder is
+// empty to begin with. With a flatbed source most backends return a single
+// page. Empty frames, which some feeders produce between pages, are skipped,
+// but ErrEmptyFrame is returned after maxEmptyFrames of them in a row. If
+// scanning fails part way, e.g. with Jammed, the pages scanned so far are
+// returned along with the error.
+func ScanAllPages(h SHandle) ([]image.Image, error) {
+	var pages []image.Image
+	empty := 0
+	for {
+		img, err := ScanImage(h)
+		if err == NoDocs && len(pages) > 0 {
+			return pages, nil
+		}
+		if err == ErrEmptyFrame && empty < maxEmptyFrames-1 {
+			empty++
+			continue
+		}
+		if err != nil {
+			return pages, err
+		}
+		empty = 0
+		pages = append(pages, img)
+	}
+}
+
+// maxEmptyFrames is the number of consecutive empty frames after which
+// ScanAllPages gives up, so that a backend that keeps returning them does
+// not make it loop forever.
+const maxEmptyFrames = 3
+
+// DocumentOptions controls ScanDocument.
+type DocumentOptions struct {
+	// Resolution in dpi. Zero keeps the current resolution.
+	Resolution float64
+
+	// Mode is the scan mode, e.g. ValueScanModeGray. Empty keeps the
+	// current mode.
+	Mode SStringConst
+
+	// Duplex selects the duplex source of the document feeder.
+	Duplex bool
+
+	// SkipBlank drops pages IsBlankPage considers blank.
+	SkipBlank bool
+
+	// AutoCrop trims the white margins of each page with AutoCrop.
+	AutoCrop bool
+
+	// Invert produces the negative of each page, using the negative option
+	// of the device when it has one and Invert otherwise.
+	Invert bool
+}
+
+// setNegative turns on the negative option of h and reports whether the
+// device has one, in which case the backend inverts the image itself.
+// Emulated options are ignored when PreferGoEmulation is on.
+func setNegative(h SHandle) (bool, error) {
+	_, d, err := FindOption(h, NameNegative)
+	if err == Unsupported || err == nil && (d.Type != TypeBool || d.Cap&Inactive != 0 || skipEmulated(d)) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if _, err := setBoolOption(h, NameNegative, true); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// defaultDocumentDPI is the resolution ScanDocument assumes for devices
+// without a resolution option, which maps each pixel to a PDF point.
+const defaultDocumentDPI = 72
+
+// ScanDocument scans every page in the document feeder of h and returns them
+// as a PDF document, configured by opts. NoDocs is returned if no page is
+// left once blank pages have been skipped. Opts.Resolution is ignored by
+// devices without a resolution option, other than for sizing the pages. The
+// options ScanDocument changes, such as the mode, resolution and source, are
+// restored afterwards.
+func ScanDocument(h SHandle, opts DocumentOptions) (pdf []byte, err error) {
+	state, err := Snapshot(h)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if rerr := Restore(h, state); err == nil {
+			err = rerr
+		}
+	}()
+
+	if opts.Mode != "" {
+		if err := SetColorMode(h, opts.Mode); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Resolution > 0 {
+		_, _, err := setFloatOption(h, NameScanResolution, opts.Resolution)
+		if err != nil && err != Unsupported {
+			return nil, err
+		}
+	}
+	if opts.Duplex {
+		_, err := setStringListOption(h, NameScanSource, func(v string) bool {
+			return strings.Contains(strings.ToLower(v), "duplex")
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	softInvert := false
+	if opts.Invert {
+		negative, err := setNegative(h)
+		if err != nil {
+			return nil, err
+		}
+		softInvert = !negative
+	}
+	dpi, _, err := getFloatOption(h, NameScanResolution)
+	switch {
+	case err == Unsupported && opts.Resolution > 0:
+		dpi = opts.Resolution
+	case err == Unsupported:
+		dpi = defaultDocumentDPI
+	case err != nil:
+		return nil, err
+	}
+
+	pages, err := ScanAllPages(h)
+	if err != nil {
+		return nil, err
+	}
+	var kept []image.Image
+	for _, img := range pages {
+		if softInvert {
+			img = Invert(img)
+		}
+		if opts.SkipBlank && IsBlankPage(img) {
+			continue
+		}
+		if opts.AutoCrop {
+			img = AutoCrop(img)
+		}
+		kept = append(kept, img)
+	}
+	if len(kept) == 0 {
+		return nil, NoDocs
+	}
+
+	var buf bytes.Buffer
+	if err := WritePDF(&buf, kept, dpi); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"bytes"
+	"testing"
+)
+
+// feedSheets makes f behave like a document feeder holding one sheet per
+// element of sheets, each a frame of the current params, after which Start
+// fails with NoDocs.
+func feedSheets(f *fakeBackend, sheets ...[]byte) {
+	f.onStart = func() error {
+		if len(sheets) == 0 {
+			return NoDocs
+		}
+		f.data, sheets = sheets[0], sheets[1:]
+		return nil
+	}
+}
+
+func TestScanDocumentNegative(t *testing.T) {
+	f := newFakeBackend()
+	f.addOption(OptionDescriptor{Name: NameNegative, Type: TypeBool, Size: 4, Cap: SoftSelect | SoftDetect}, SFALSE)
+	h := setupFake(t, f)
+	defer Exit()
+
+	feedSheets(f, []byte{0, 1, 2, 3, 4, 5, 6, 7})
+	feed := f.onStart
+	var during SWord
+	f.onStart = func() error {
+		during = f.option(NameNegative).words[0]
+		return feed()
+	}
+	pdf, err := ScanDocument(h, DocumentOptions{Invert: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		t.Error("ScanDocument did not return a PDF")
+	}
+	if on, _ := getBoolOption(h, NameNegative); on {
+		t.Error("ScanDocument left the negative option on")
+	}
+	if during != STRUE {
+		t.Error("the negative option was off during the scan")
+	}
+}
+
+func TestScanDocumentRestores(t *testing.T) {
+	f := newFakeBackend()
+	f.addOption(OptionDescriptor{Name: NameScanSource, Type: TypeString, Size: 16, Cap: SoftSelect | SoftDetect,
+		Constraint: StringListConstraint{"Flatbed", "ADF Duplex"}}, "Flatbed")
+	h := setupFake(t, f)
+	defer Exit()
+
+	dark := []byte{0, 1, 2, 3, 4, 5, 6, 7}
+	blank := bytes.Repeat([]byte{0xff}, 8)
+	feedSheets(f, dark, blank, dark)
+	pdf, err := ScanDocument(h, DocumentOptions{Mode: "Gray", Resolution: 150, Duplex: true, SkipBlank: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(pdf, []byte("/Count 2 ")) {
+		t.Error("the PDF does not hold the two non-blank pages")
+	}
+	if v := f.option(NameScanMode).str; v != "Color" {
+		t.Errorf("mode left at %q", v)
+	}
+	if v := f.option(NameScanResolution).words[0]; v != 300 {
+		t.Errorf("resolution left at %d", v)
+	}
+	if v := f.option(NameScanSource).str; v != "Flatbed" {
+		t.Errorf("source left at %q", v)
+	}
+}
+
+func TestScanDocumentNoResolution(t *testing.T) {
+	f := newFakeBackend()
+	f.option(NameScanResolution).desc.Name = "x-resolution"
+	h := setupFake(t, f)
+	defer Exit()
+
+	feedSheets(f, []byte{0, 1, 2, 3, 4, 5, 6, 7})
+	pdf, err := ScanDocument(h, DocumentOptions{Resolution: 150})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		t.Error("ScanDocument did not return a PDF")
+	}
+}
+
+func TestScanAllPagesJammed(t *testing.T) {
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	defer Exit()
+
+	sheet := []byte{0, 1, 2, 3, 4, 5, 6, 7}
+	feedSheets(f, sheet, sheet)
+	feed := f.onStart
+	f.onStart = func() error {
+		if err := feed(); err != NoDocs {
+			return err
+		}
+		return Jammed
+	}
+	pages, err := ScanAllPages(h)
+	if err != Jammed || len(pages) != 2 {
+		t.Errorf("ScanAllPages = %d pages, %v; want 2 pages, Jammed", len(pages), err)
+	}
+}
+
+func TestScanAllPagesEmptyFrames(t *testing.T) {
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	defer Exit()
+
+	feedSheets(f, []byte{0, 1, 2, 3, 4, 5, 6, 7}, nil, nil, nil)
+	pages, err := ScanAllPages(h)
+	if err != ErrEmptyFrame || len(pages) != 1 {
+		t.Errorf("ScanAllPages = %d pages, %v; want 1 page, ErrEmptyFrame", len(pages), err)
+	}
+}
+
+func TestPreferGoEmulation(t *testing.T) {
+	if (SoftSelect | SoftDetect).IsEmulated() || !(SoftSelect | Emulated).IsEmulated() {
+		t.Error("IsEmulated does not test the Emulated capability")
+	}
+
+	f := newFakeBackend()
+	f.addOption(OptionDescriptor{Name: NameNegative, Type: TypeBool, Size: 4, Cap: SoftSelect | SoftDetect | Emulated}, SFALSE)
+	h := setupFake(t, f)
+	defer Exit()
+	defer PreferGoEmulation(false)
+
+	// By default the backend's emulation is used.
+	if used, err := setNegative(h); !used || err != nil || f.option(NameNegative).words[0] != STRUE {
+		t.Errorf("setNegative = %v, %v; want the emulated option used", used, err)
+	}
+
+	f.option(NameNegative).words[0] = SFALSE
+	PreferGoEmulation(true)
+	if used, err := setNegative(h); used || err != nil || f.option(NameNegative).words[0] != SFALSE {
+		t.Errorf("setNegative preferring Go = %v, %v; want the option left alone", used, err)
+	}
+	// Options the device implements itself are still used.
+	f.option(NameNegative).desc.Cap &^= Emulated
+	if used, err := setNegative(h); !used || err != nil {
+		t.Errorf("setNegative of a native option preferring Go = %v, %v; want it used", used, err)
+	}
+}
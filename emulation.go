@@ -0,0 +1,36 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"sync"
+)
+
+var (
+	emulationMu       sync.RWMutex
+	preferGoEmulation bool
+)
+
+// PreferGoEmulation decides what the high-level helpers do when the device
+// option that would do their work, such as the negative option used by
+// ScanDocument for DocumentOptions.Invert, has the Emulated capability.
+//
+// By default such options are used like any other, since the backend may
+// know its device better. With prefer set, they are ignored and gosane's own
+// implementation (e.g. Invert) is used instead, which gives the same result
+// whatever the backend.
+func PreferGoEmulation(prefer bool) {
+	emulationMu.Lock()
+	preferGoEmulation = prefer
+	emulationMu.Unlock()
+}
+
+// skipEmulated reports whether the high-level helpers should ignore the
+// option described by d in favor of gosane's implementation.
+func skipEmulated(d *OptionDescriptor) bool {
+	emulationMu.RLock()
+	defer emulationMu.RUnlock()
+	return preferGoEmulation && d.Cap.IsEmulated()
+}
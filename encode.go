@@ -0,0 +1,304 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// is16Bit reports whether img holds 16-bit samples.
+func is16Bit(img image.Image) bool {
+	m := img.ColorModel()
+	return m == color.Gray16Model || m == color.RGBA64Model || m == color.NRGBA64Model
+}
+
+// writeSamples writes the samples of img row by row to w using order for
+// 16-bit samples. Gray images have one sample per pixel, all others three.
+func writeSamples(w io.Writer, img image.Image, order binary.ByteOrder) error {
+	b := img.Bounds()
+	gray, wide := isGray(img), is16Bit(img)
+	bw := bufio.NewWriter(w)
+	var buf [2]byte
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			samples := []uint32{r, g, bl}
+			if gray {
+				samples = samples[:1]
+			}
+			for _, s := range samples {
+				if wide {
+					order.PutUint16(buf[:], uint16(s))
+					bw.Write(buf[:])
+				} else {
+					bw.WriteByte(byte(s >> 8))
+				}
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// WritePNM writes img to w as a binary PGM (gray images) or PPM (all others)
+// file. 16-bit images are written with a maxval of 65535.
+func WritePNM(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	magic, maxval := "P6", 255
+	if isGray(img) {
+		magic = "P5"
+	}
+	if is16Bit(img) {
+		maxval = 65535
+	}
+	if _, err := fmt.Fprintf(w, "%s\n%d %d\n%d\n", magic, b.Dx(), b.Dy(), maxval); err != nil {
+		return err
+	}
+	return writeSamples(w, img, binary.BigEndian)
+}
+
+// WritePNG writes img to w as a PNG file, embedding the profile set by
+// SetOutputICCProfile if any.
+func WritePNG(w io.Writer, img image.Image) error {
+	return writePNG(w, img, 0, 0)
+}
+
+// writePNG is like WritePNG, but also records the resolution of img in a
+// pHYs chunk when xdpi and ydpi are known (positive).
+func writePNG(w io.Writer, img image.Image, xdpi, ydpi float64) error {
+	profile := currentICCProfile()
+	withDPI := xdpi > 0 && ydpi > 0
+	if profile == nil && !withDPI {
+		return png.Encode(w, img)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	var err error
+	if profile != nil {
+		if data, err = pngInsertICCP(data, profile); err != nil {
+			return err
+		}
+	}
+	if withDPI {
+		if data, err = pngInsertChunk(data, "pHYs", pngPHYs(xdpi, ydpi)); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// pngPHYs returns the body of a pHYs chunk for a resolution of xdpi by
+// ydpi, which PNG records in pixels per meter.
+func pngPHYs(xdpi, ydpi float64) []byte {
+	body := make([]byte, 9)
+	binary.BigEndian.PutUint32(body, uint32(math.Round(xdpi/0.0254)))
+	binary.BigEndian.PutUint32(body[4:], uint32(math.Round(ydpi/0.0254)))
+	body[8] = 1 // the unit is the meter
+	return body
+}
+
+// WriteJPEG writes img to w as a JPEG file with the given quality (1-100),
+// embedding the profile set by SetOutputICCProfile if any.
+func WriteJPEG(w io.Writer, img image.Image, quality int) error {
+	profile := currentICCProfile()
+	if profile == nil {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return err
+	}
+	data, err := jpegInsertICC(buf.Bytes(), profile)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// TIFF tag numbers and field types used by WriteTIFF.
+const (
+	tiffImageWidth                = 256
+	tiffImageLength               = 257
+	tiffBitsPerSample             = 258
+	tiffCompression               = 259
+	tiffPhotometricInterpretation = 262
+	tiffStripOffsets              = 273
+	tiffSamplesPerPixel           = 277
+	tiffRowsPerStrip              = 278
+	tiffStripByteCounts           = 279
+	tiffICCProfile                = 34675
+
+	tiffShort     = 3
+	tiffLong      = 4
+	tiffUndefined = 7
+)
+
+// WriteTIFF writes img to w as an uncompressed, single strip, little endian
+// baseline TIFF file, embedding the profile set by SetOutputICCProfile if
+// any.
+func WriteTIFF(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	spp, bps, photometric := 3, 8, 2
+	if isGray(img) {
+		spp, photometric = 1, 1
+	}
+	if is16Bit(img) {
+		bps = 16
+	}
+	size := b.Dx() * b.Dy() * spp * bps / 8
+
+	type entry struct {
+		tag, typ uint16
+		count    uint32
+		value    uint32
+	}
+	profile := currentICCProfile()
+	numEntries := 9
+	if profile != nil {
+		numEntries++
+	}
+	ifdSize := 2 + numEntries*12 + 4
+	bpsOffset := 8 + ifdSize
+	profileOffset := bpsOffset + 2*spp
+	dataOffset := profileOffset + len(profile)
+
+	bpsEntry := entry{tiffBitsPerSample, tiffShort, uint32(spp), uint32(bps)}
+	if spp > 1 {
+		bpsEntry.value = uint32(bpsOffset)
+	}
+	entries := []entry{
+		{tiffImageWidth, tiffLong, 1, uint32(b.Dx())},
+		{tiffImageLength, tiffLong, 1, uint32(b.Dy())},
+		bpsEntry,
+		{tiffCompression, tiffShort, 1, 1},
+		{tiffPhotometricInterpretation, tiffShort, 1, uint32(photometric)},
+		{tiffStripOffsets, tiffLong, 1, uint32(dataOffset)},
+		{tiffSamplesPerPixel, tiffShort, 1, uint32(spp)},
+		{tiffRowsPerStrip, tiffLong, 1, uint32(b.Dy())},
+		{tiffStripByteCounts, tiffLong, 1, uint32(size)},
+	}
+	if profile != nil {
+		entries = append(entries, entry{tiffICCProfile, tiffUndefined, uint32(len(profile)), uint32(profileOffset)})
+	}
+
+	le := binary.LittleEndian
+	hdr := make([]byte, dataOffset)
+	copy(hdr, "II*\x00")
+	le.PutUint32(hdr[4:], 8)
+	le.PutUint16(hdr[8:], uint16(numEntries))
+	for i, e := range entries {
+		p := hdr[10+12*i:]
+		le.PutUint16(p, e.tag)
+		le.PutUint16(p[2:], e.typ)
+		le.PutUint32(p[4:], e.count)
+		if e.typ == tiffShort && e.count == 1 {
+			le.PutUint16(p[8:], uint16(e.value))
+		} else {
+			le.PutUint32(p[8:], e.value)
+		}
+	}
+	for i := 0; i < spp; i++ {
+		le.PutUint16(hdr[bpsOffset+2*i:], uint16(bps))
+	}
+	copy(hdr[profileOffset:], profile)
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	return writeSamples(w, img, le)
+}
+
+// formatFromPath infers an output format from the extension of path.
+func formatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pnm", ".pgm", ".ppm":
+		return "pnm"
+	case ".png":
+		return "png"
+	case ".jpg", ".jpeg":
+		return "jpeg"
+	case ".tif", ".tiff":
+		return "tiff"
+	}
+	return ""
+}
+
+// encodeImage writes the image of r to w in format, which is one of "pnm",
+// "png", "jpeg" or "tiff". The resolution of r is recorded in PNG files.
+func encodeImage(w io.Writer, r *Result, format string) error {
+	switch format {
+	case "pnm":
+		return WritePNM(w, r.Image)
+	case "png":
+		return r.WritePNG(w)
+	case "jpeg":
+		return WriteJPEG(w, r.Image, jpeg.DefaultQuality)
+	case "tiff":
+		return WriteTIFF(w, r.Image)
+	}
+	return &LibError{Op: "encode", Err: fmt.Errorf("unknown image format %q", format)}
+}
+
+// writeFileAtomic writes the output of write to a temporary file next to
+// path and renames it to path once complete, so that path is never left
+// holding a partial file.
+func writeFileAtomic(path string, write func(io.Writer) error) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	err = write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// ScanToFile scans an image from h and writes it to path in format, which is
+// one of "pnm", "png", "jpeg" or "tiff". If format is empty it is inferred
+// from the extension of path. The image is written to a temporary file that
+// is renamed to path on success, so no partial file is left behind on error.
+// PNG files record the resolution the image was scanned at in a pHYs chunk,
+// so that other tools see its physical size.
+func ScanToFile(h SHandle, path string, format string) error {
+	if format == "" {
+		format = formatFromPath(path)
+	}
+	switch format {
+	case "pnm", "png", "jpeg", "tiff":
+	default:
+		return &LibError{Op: "ScanToFile", Err: fmt.Errorf("unknown image format %q", format)}
+	}
+	r, err := ScanResult(h)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, func(w io.Writer) error {
+		return encodeImage(w, r, format)
+	})
+}
@@ -0,0 +1,145 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// decodePNM decodes a binary 8-bit PGM or PPM file into its size and
+// samples.
+func decodePNM(data []byte) (w, h int, samples []byte, err error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	var magic string
+	var maxval int
+	if _, err := fmt.Fscanf(r, "%s\n%d %d\n%d\n", &magic, &w, &h, &maxval); err != nil {
+		return 0, 0, nil, err
+	}
+	if (magic != "P5" && magic != "P6") || maxval != 255 {
+		return 0, 0, nil, fmt.Errorf("unexpected PNM header %s %d", magic, maxval)
+	}
+	samples, err = ioutil.ReadAll(r)
+	return w, h, samples, err
+}
+
+// decodeTIFF decodes an uncompressed single strip little endian TIFF file
+// as written by WriteTIFF into its size and samples.
+func decodeTIFF(data []byte) (w, h int, samples []byte, err error) {
+	le := binary.LittleEndian
+	if len(data) < 8 || string(data[:4]) != "II*\x00" {
+		return 0, 0, nil, fmt.Errorf("not a little endian TIFF file")
+	}
+	ifd := data[le.Uint32(data[4:]):]
+	var offset, count int
+	for i := 0; i < int(le.Uint16(ifd)); i++ {
+		e := ifd[2+12*i:]
+		v := int(le.Uint32(e[8:]))
+		if le.Uint16(e[2:]) == tiffShort {
+			v = int(le.Uint16(e[8:]))
+		}
+		switch le.Uint16(e) {
+		case tiffImageWidth:
+			w = v
+		case tiffImageLength:
+			h = v
+		case tiffStripOffsets:
+			offset = v
+		case tiffStripByteCounts:
+			count = v
+		}
+	}
+	if offset+count > len(data) {
+		return 0, 0, nil, fmt.Errorf("strip runs past the end of the file")
+	}
+	return w, h, data[offset : offset+count], nil
+}
+
+func TestScanToFile(t *testing.T) {
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	defer Exit()
+	dir, err := ioutil.TempDir("", "gosane")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := SetResolutionXY(h, 150, 150); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name   string
+		params Parameters
+		size   int
+	}{
+		{"gray", Parameters{Format: FrameGray, LastFrame: STRUE, BytesPerLine: 4, PixelsPerLine: 4, Lines: 3, Depth: 8}, 12},
+		{"rgb", Parameters{Format: FrameRGB, LastFrame: STRUE, BytesPerLine: 12, PixelsPerLine: 4, Lines: 3, Depth: 8}, 36},
+	} {
+		f.params = c.params
+		f.data = make([]byte, c.size)
+		for i := range f.data {
+			f.data[i] = byte(i * 20)
+		}
+		for _, ext := range []string{".pnm", ".png", ".jpg", ".tiff"} {
+			path := filepath.Join(dir, c.name+ext)
+			if err := ScanToFile(h, path, ""); err != nil {
+				t.Fatalf("%s: %v", path, err)
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var w, ht int
+			switch ext {
+			case ".pnm", ".tiff":
+				decode := decodePNM
+				if ext == ".tiff" {
+					decode = decodeTIFF
+				}
+				var samples []byte
+				w, ht, samples, err = decode(data)
+				if err == nil && !bytes.Equal(samples, f.data) {
+					t.Errorf("%s: samples %v, want %v", path, samples, f.data)
+				}
+			case ".png":
+				var img image.Image
+				if img, err = png.Decode(bytes.NewReader(data)); err == nil {
+					w, ht = img.Bounds().Dx(), img.Bounds().Dy()
+				}
+				// The fake scans at 150 dpi, 5906 pixels per meter.
+				if x, y, unit, ok := pngPHYsChunk(t, data); !ok || x != 5906 || y != 5906 || unit != 1 {
+					t.Errorf("%s: pHYs chunk %d, %d, unit %d (present %v); want 5906, 5906, meter", path, x, y, unit, ok)
+				}
+			case ".jpg":
+				var img image.Image
+				if img, err = jpeg.Decode(bytes.NewReader(data)); err == nil {
+					w, ht = img.Bounds().Dx(), img.Bounds().Dy()
+				}
+			}
+			if err != nil {
+				t.Errorf("%s: %v", path, err)
+			} else if w != 4 || ht != 3 {
+				t.Errorf("%s: decoded a %dx%d image, want 4x3", path, w, ht)
+			}
+		}
+	}
+
+	if err := ScanToFile(h, filepath.Join(dir, "scan.bmp"), ""); err == nil {
+		t.Error("ScanToFile accepted an unknown format")
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, ".*")); len(files) != 0 {
+		t.Errorf("temporary files left behind: %v", files)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"errors"
+	"fmt"
+)
+
+// LibError reports a problem with the use of gosane itself (a closed handle,
+// a missing Init, a value of the wrong type, ...), as opposed to an SStatus,
+// which is reported by the backend. A LibError usually means the calling code
+// needs fixing, whereas some SStatus errors (e.g. DeviceBusy) can be retried.
+// Use errors.As to tell the two apart.
+type LibError struct {
+	// Op is the operation that failed.
+	Op string
+
+	// Err is the underlying error, usually one of the Err* variables.
+	Err error
+}
+
+func (e *LibError) Error() string {
+	return "gosane: " + e.Op + ": " + e.Err.Error()
+}
+
+func (e *LibError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	// ErrNoBackend is returned when no Backend has been installed with
+	// SetBackend.
+	ErrNoBackend = errors.New("no backend installed")
+
+	// ErrNotInitialized is returned by operations called before Init.
+	ErrNotInitialized = errors.New("Init has not been called")
+
+	// ErrClosed is returned by operations on a closed Scanner.
+	ErrClosed = errors.New("scanner is closed")
+
+	// ErrTypeMismatch is returned when an option value does not match the
+	// type of the option.
+	ErrTypeMismatch = errors.New("value does not match option type")
+
+	// ErrAmbiguousTitle is returned when more than one option has the
+	// title being looked up.
+	ErrAmbiguousTitle = errors.New("more than one option has this title")
+
+	// ErrOptionInactive is returned when setting an option whose Inactive
+	// capability is set.
+	ErrOptionInactive = errors.New("option is inactive")
+
+	// ErrNotStarted is returned by Read on a handle that has not been
+	// started with Start.
+	ErrNotStarted = errors.New("Read called before Start")
+
+	// ErrScanInProgress is returned when setting an option while its
+	// handle is acquiring, unless the option has the AlwaysSettable
+	// capability.
+	ErrScanInProgress = errors.New("option cannot be set during a scan")
+
+	// ErrTimeout is returned when an operation with a deadline, such as
+	// ReadTimeout, took too long and was cancelled. It is distinct from
+	// Cancelled, which is returned when Cancel is called explicitly.
+	ErrTimeout = errors.New("operation timed out")
+
+	// ErrEmptyFrame is returned when a frame ends before any image data
+	// was read, as some backends do between the pages of a document
+	// feeder, instead of an image with no pixels.
+	ErrEmptyFrame = errors.New("frame holds no image data")
+)
+
+// typeMismatch returns a LibError for a value of the wrong type for the
+// option named name.
+func typeMismatch(name SStringConst) error {
+	return &LibError{Op: "option " + string(name), Err: ErrTypeMismatch}
+}
+
+// VersionMismatch is returned by Init when the major SANE version of the
+// backend differs from the one targeted. Initialization has still succeeded,
+// so callers confident in their compatibility may ignore it.
+type VersionMismatch struct {
+	// Want is the version code targeted.
+	Want SInt
+
+	// Got is the version code reported by the backend.
+	Got SInt
+}
+
+func (e *VersionMismatch) Error() string {
+	return fmt.Sprintf("gosane: backend implements SANE %d.%d.%d, want major version %d",
+		VersionMajor(e.Got), VersionMinor(e.Got), VersionBuild(e.Got), VersionMajor(e.Want))
+}
+
+// FrameMismatch is returned when the frames of a multi-frame image do not
+// share the same geometry, as reported by GetParameters, so they cannot be
+// combined into one image.
+type FrameMismatch struct {
+	// Frame is the index of the offending frame, counting from 0.
+	Frame int
+
+	// Field is the name of the Parameters field that changed, e.g.
+	// "BytesPerLine".
+	Field string
+
+	// Want is the value of Field in the first frame, and Got its value in
+	// Frame.
+	Want, Got SInt
+}
+
+func (e *FrameMismatch) Error() string {
+	return fmt.Sprintf("gosane: frame %d has %s %d, first frame had %d", e.Frame, e.Field, e.Got, e.Want)
+}
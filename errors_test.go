@@ -0,0 +1,36 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLibErrorVersusStatus(t *testing.T) {
+	SetBackend(nil)
+	var le *LibError
+	if err := Init(0, nil); !errors.As(err, &le) || !errors.Is(err, ErrNoBackend) {
+		t.Errorf("Init without a backend = %v, want a LibError wrapping ErrNoBackend", err)
+	}
+
+	f := newFakeBackend()
+	SetBackend(f)
+	if _, err := Open("fake:0"); !errors.As(err, &le) || le.Op != "Open" || !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("Open before Init = %v, want a LibError wrapping ErrNotInitialized", err)
+	}
+
+	h := setupFake(t, f)
+	defer Exit()
+	f.onStart = func() error { return DeviceBusy }
+	err := Start(h)
+	var status SStatus
+	if errors.As(err, &le) || !errors.As(err, &status) || status != DeviceBusy {
+		t.Errorf("Start = %v, want the backend's DeviceBusy status", err)
+	}
+	if msg := (&LibError{Op: "Read", Err: ErrNotStarted}).Error(); msg != "gosane: Read: Read called before Start" {
+		t.Errorf("LibError message %q", msg)
+	}
+}
@@ -0,0 +1,355 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"sync"
+	"testing"
+)
+
+// fakeOption is an option of a fakeBackend: words holds the value of
+// TypeBool, TypeInt and TypeFixed options, str that of TypeString options.
+type fakeOption struct {
+	desc  OptionDescriptor
+	words []SWord
+	str   string
+}
+
+// fakeBackend is an in-memory Backend emulating a flatbed scanner, for
+// tests. Each Start begins a frame described by params, whose data is then
+// returned by Read in chunks of at most chunk bytes. Tests adjust its fields
+// and hooks, with mu held if the backend may be in use, to simulate
+// specific devices.
+type fakeBackend struct {
+	mu sync.Mutex
+
+	opts    []*fakeOption
+	devices []Device
+	params  Parameters
+	data    []byte
+	chunk   int
+
+	// onStart, if set, is called by Start with mu held. An error it returns
+	// is returned by Start; otherwise a new frame begins, so onStart may
+	// change params and data for it.
+	onStart func() error
+
+	// onSet, if set, is called by ControlOption with mu held after option
+	// n has been set, and its result is returned as the Info.
+	onSet func(n SInt) Info
+
+	// readErr, if set, is returned by Read instead of Eof at the end of
+	// the data, and failRead by every Read.
+	readErr  error
+	failRead error
+
+	// controlErr, if set, is returned by every ControlOption.
+	controlErr error
+
+	// openBlock, if set, makes Open wait until it is closed, after sending
+	// on openWaiting if that is set too.
+	openBlock   chan struct{}
+	openWaiting chan struct{}
+
+	// block, if set, makes Read wait after the first chunk of a frame
+	// until Cancel or Close is called, and then fail with Cancelled.
+	block chan struct{}
+
+	pos     int
+	started bool
+	handles map[SHandle]bool
+	auto    map[SInt]bool // options in automatic mode
+	calls   []string
+	reads   []int // buffer sizes passed to Read
+}
+
+// newFakeBackend returns a fakeBackend listing a single device, fake:0, with
+// the options of a typical flatbed scanner: resolution, mode and the four
+// geometry options.
+func newFakeBackend() *fakeBackend {
+	f := &fakeBackend{chunk: 1 << 20, handles: make(map[SHandle]bool), auto: make(map[SInt]bool)}
+	f.devices = []Device{{Name: "fake:0", Vendor: "Noname", Model: "Flatbed", DeviceType: "flatbed scanner"}}
+	f.opts = []*fakeOption{{desc: OptionDescriptor{Type: TypeInt, Size: 4, Cap: SoftDetect}, words: []SWord{0}}}
+	f.addOption(OptionDescriptor{Name: NameScanResolution, Type: TypeInt, Unit: UnitDpi, Size: 4,
+		Cap: SoftSelect | SoftDetect | Automatic, Constraint: WordListConstraint{75, 150, 300}}, 300)
+	f.addOption(OptionDescriptor{Name: NameScanMode, Type: TypeString, Size: 16,
+		Cap: SoftSelect | SoftDetect, Constraint: StringListConstraint{"Color", "Gray", "Lineart"}}, "Color")
+	xr := RangeConstraint{SRange{Max: SWord(FloatToFixed(215.9))}}
+	yr := RangeConstraint{SRange{Max: SWord(FloatToFixed(297))}}
+	for _, o := range []struct {
+		name SStringConst
+		r    RangeConstraint
+		v    float64
+	}{{NameScanTLX, xr, 0}, {NameScanTLY, yr, 0}, {NameScanBRX, xr, 215.9}, {NameScanBRY, yr, 297}} {
+		f.addOption(OptionDescriptor{Name: o.name, Type: TypeFixed, Unit: UnitMm, Size: 4,
+			Cap: SoftSelect | SoftDetect, Constraint: o.r}, SWord(FloatToFixed(o.v)))
+	}
+	f.params = Parameters{Format: FrameGray, LastFrame: STRUE, BytesPerLine: 4, PixelsPerLine: 4, Lines: 2, Depth: 8}
+	f.data = []byte{0, 1, 2, 3, 4, 5, 6, 7}
+	return f
+}
+
+// addOption appends an option described by d with value v, an int, SWord
+// or string, and returns its number.
+func (f *fakeBackend) addOption(d OptionDescriptor, v interface{}) SInt {
+	o := &fakeOption{desc: d}
+	switch v := v.(type) {
+	case int:
+		o.words = make([]SWord, d.Size/4)
+		for i := range o.words {
+			o.words[i] = SWord(v)
+		}
+	case SWord:
+		o.words = make([]SWord, d.Size/4)
+		for i := range o.words {
+			o.words[i] = v
+		}
+	case string:
+		o.str = v
+	}
+	f.opts = append(f.opts, o)
+	f.opts[0].words[0] = SWord(len(f.opts))
+	return SInt(len(f.opts) - 1)
+}
+
+// option returns the option named name, or nil.
+func (f *fakeBackend) option(name SStringConst) *fakeOption {
+	for _, o := range f.opts[1:] {
+		if o.desc.Name == name {
+			return o
+		}
+	}
+	return nil
+}
+
+// called returns the names of the Backend methods called so far.
+func (f *fakeBackend) called() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func (f *fakeBackend) record(op string) {
+	f.calls = append(f.calls, op)
+}
+
+func (f *fakeBackend) Init(authorize AuthorizationCallback) (SInt, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Init")
+	return VersionCode(CurrentMajor, CurrentMinor, 0), nil
+}
+
+func (f *fakeBackend) Exit() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Exit")
+}
+
+func (f *fakeBackend) GetDevices(localOnly bool) ([]Device, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetDevices")
+	return append([]Device(nil), f.devices...), nil
+}
+
+func (f *fakeBackend) Open(name SStringConst) (SHandle, error) {
+	f.mu.Lock()
+	if block := f.openBlock; block != nil {
+		waiting := f.openWaiting
+		f.mu.Unlock()
+		if waiting != nil {
+			waiting <- struct{}{}
+		}
+		<-block
+		f.mu.Lock()
+	}
+	defer f.mu.Unlock()
+	f.record("Open")
+	h := SHandle(new(int))
+	f.handles[h] = true
+	return h, nil
+}
+
+func (f *fakeBackend) Close(h SHandle) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Close")
+	delete(f.handles, h)
+	f.unblock()
+}
+
+// isOpen reports whether h was opened and not closed.
+func (f *fakeBackend) isOpen(h SHandle) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.handles[h]
+}
+
+func (f *fakeBackend) GetOptionDescriptor(h SHandle, n SInt) *OptionDescriptor {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetOptionDescriptor")
+	if n < 0 || int(n) >= len(f.opts) {
+		return nil
+	}
+	return &f.opts[n].desc
+}
+
+func (f *fakeBackend) ControlOption(h SHandle, n SInt, a Action, v interface{}) (Info, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("ControlOption")
+	if f.controlErr != nil {
+		return 0, f.controlErr
+	}
+	if !f.handles[h] {
+		return 0, Inval
+	}
+	if n < 0 || int(n) >= len(f.opts) {
+		return 0, Inval
+	}
+	o := f.opts[n]
+	switch a {
+	case ActionGetValue:
+		switch b := v.(type) {
+		case []SWord:
+			copy(b, o.words)
+		case SString:
+			copy(b, o.str)
+		default:
+			return 0, Inval
+		}
+		return 0, nil
+	case ActionSetAuto:
+		if o.desc.Cap&Automatic == 0 {
+			return 0, Inval
+		}
+		if o.desc.Name == NameScanResolution {
+			o.words[0] = 150
+		}
+		f.auto[n] = true
+	case ActionSetValue:
+		if o.desc.Cap&SoftSelect == 0 || o.desc.Cap&Inactive != 0 {
+			return 0, Inval
+		}
+		switch b := v.(type) {
+		case []SWord:
+			copy(o.words, b)
+		case SString:
+			o.str = trimNUL(b)
+		case nil:
+			if o.desc.Type != TypeButton {
+				return 0, Inval
+			}
+		default:
+			return 0, Inval
+		}
+		delete(f.auto, n)
+	}
+	if f.onSet != nil {
+		return f.onSet(n), nil
+	}
+	return 0, nil
+}
+
+func (f *fakeBackend) GetParameters(h SHandle) (*Parameters, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetParameters")
+	p := f.params
+	return &p, nil
+}
+
+func (f *fakeBackend) Start(h SHandle) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Start")
+	if f.onStart != nil {
+		if err := f.onStart(); err != nil {
+			return err
+		}
+	}
+	f.pos, f.started = 0, true
+	return nil
+}
+
+func (f *fakeBackend) Read(h SHandle, buf []byte) (int, error) {
+	f.mu.Lock()
+	f.record("Read")
+	f.reads = append(f.reads, len(buf))
+	if f.block != nil && f.pos > 0 {
+		block := f.block
+		f.mu.Unlock()
+		<-block
+		return 0, Cancelled
+	}
+	defer f.mu.Unlock()
+	if !f.handles[h] {
+		return 0, Inval
+	}
+	if f.failRead != nil {
+		return 0, f.failRead
+	}
+	if f.pos >= len(f.data) {
+		if f.readErr != nil {
+			return 0, f.readErr
+		}
+		return 0, Eof
+	}
+	n := len(buf)
+	if n > f.chunk {
+		n = f.chunk
+	}
+	n = copy(buf[:n], f.data[f.pos:])
+	f.pos += n
+	return n, nil
+}
+
+func (f *fakeBackend) Cancel(h SHandle) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Cancel")
+	f.started = false
+	f.unblock()
+}
+
+// unblock releases a Read waiting on block. It must be called with mu held.
+func (f *fakeBackend) unblock() {
+	if f.block != nil {
+		close(f.block)
+		f.block = nil
+	}
+}
+
+func (f *fakeBackend) SetIOMode(h SHandle, nonBlocking bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("SetIOMode")
+	return Unsupported
+}
+
+func (f *fakeBackend) GetSelectFd(h SHandle) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetSelectFd")
+	return -1, Unsupported
+}
+
+// setupFake installs f, initializes it and opens a handle. Callers must
+// call Exit once done.
+func setupFake(t *testing.T, f *fakeBackend) SHandle {
+	t.Helper()
+	SetBackend(f)
+	if err := Init(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	h, err := Open("fake:0")
+	if err != nil {
+		Exit()
+		t.Fatal(err)
+	}
+	return h
+}
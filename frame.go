@@ -0,0 +1,469 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// readChunkSize is the default size of the reads issued while acquiring a
+// frame.
+const readChunkSize = 32 * 1024
+
+// SetReadChunkSize sets the size in bytes of the reads ScanImage and the
+// other scan functions issue on h, which must have been opened with Open,
+// in place of their defaults. Backends perform best at different sizes, and
+// some flaky USB backends corrupt large reads. An error wrapping Inval is
+// returned if n is not positive or h is not open.
+func SetReadChunkSize(h SHandle, n int) error {
+	if n <= 0 {
+		return fmt.Errorf("gosane: read chunk size %d is not positive: %w", n, Inval)
+	}
+	if !setChunkSize(h, n) {
+		return fmt.Errorf("gosane: SetReadChunkSize on a handle that is not open: %w", Inval)
+	}
+	return nil
+}
+
+// hostByteOrder is the byte order of 16-bit samples returned by Read.
+var hostByteOrder binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// Validate checks that p describes a frame that can be decoded, catching
+// degenerate values some backends report. The returned error wraps Inval.
+func (p *Parameters) Validate() error {
+	invalid := func(format string, v ...interface{}) error {
+		return fmt.Errorf("gosane: invalid parameters: %s: %w", fmt.Sprintf(format, v...), Inval)
+	}
+	spp := 1
+	switch p.Format {
+	case FrameGray, FrameRed, FrameGreen, FrameBlue:
+	case FrameRGB:
+		spp = 3
+	default:
+		return invalid("unknown format %d", p.Format)
+	}
+	if p.Depth != 1 && p.Depth != 8 && (p.Depth < 9 || p.Depth > 16) {
+		return invalid("depth %d is not 1, 8 or 9 to 16", p.Depth)
+	}
+	if p.PixelsPerLine <= 0 {
+		return invalid("%d pixels per line", p.PixelsPerLine)
+	}
+	if p.BytesPerLine <= 0 {
+		return invalid("%d bytes per line", p.BytesPerLine)
+	}
+	if p.Lines == 0 || p.Lines < -1 {
+		return invalid("%d lines", p.Lines)
+	}
+	if min := (int(p.PixelsPerLine)*spp*sampleBits(p.Depth) + 7) / 8; int(p.BytesPerLine) < min {
+		return invalid("%d bytes per line is too short for %d pixels of depth %d", p.BytesPerLine, p.PixelsPerLine, p.Depth)
+	}
+	return nil
+}
+
+// IsLastFrame reports whether p describes the last frame of an image, so
+// that no further Start is needed to complete it. Per the SANE standard any
+// nonzero LastFrame counts as true.
+func (p *Parameters) IsLastFrame() bool {
+	return p.LastFrame != SFALSE
+}
+
+// SampleJustify tells how a backend stores samples of a depth between 9
+// and 15 in their 16-bit words.
+type SampleJustify int
+
+const (
+	// SampleJustifyRight means samples are in the low bits of their word,
+	// as is most common. This is the default. The samples are decoded as
+	// they are, e.g. a 12-bit sample ranges from 0 to 0xfff.
+	SampleJustifyRight SampleJustify = iota
+
+	// SampleJustifyLeft means samples are in the high bits of their word.
+	// The samples are decoded scaled to the full 16-bit range, e.g. a 12-bit
+	// sample ranges from 0 to 0xffff.
+	SampleJustifyLeft
+)
+
+var (
+	justifyMu     sync.RWMutex
+	sampleJustify SampleJustify
+)
+
+// SetSampleJustify sets how the frames decoded by ScanImage and the other
+// scan functions store samples of a depth between 9 and 15. Right-justified
+// samples keep their value in the low bits, while left-justified ones are
+// scaled to the full 16-bit range, so the maximum 12-bit sample decodes as
+// 0xfff in the first case and as 0xffff in the second.
+func SetSampleJustify(j SampleJustify) {
+	justifyMu.Lock()
+	sampleJustify = j
+	justifyMu.Unlock()
+}
+
+// sampleBits returns the number of bits holding each sample of depth: 1, 8,
+// or 16 for depths above 8.
+func sampleBits(depth SInt) int {
+	if depth > 8 {
+		return 16
+	}
+	return int(depth)
+}
+
+// sampleScaler returns a function reading a 16-bit word in host byte order
+// holding a sample of depth. Right-justified samples are masked to depth
+// bits; left-justified ones are scaled to the full 16-bit range.
+func sampleScaler(depth SInt) func([]byte) uint16 {
+	if depth >= 16 {
+		return hostByteOrder.Uint16
+	}
+	justifyMu.RLock()
+	j := sampleJustify
+	justifyMu.RUnlock()
+	shift := uint(16 - depth)
+	return func(b []byte) uint16 {
+		v := hostByteOrder.Uint16(b)
+		if j != SampleJustifyLeft {
+			return v & (1<<uint(depth) - 1)
+		}
+		v >>= shift
+		// Replicate the high bits into the low ones so that the maximum
+		// sample maps to 0xffff.
+		return v<<shift | v>>(uint(depth)-shift)
+	}
+}
+
+// frameSize returns the size in bytes of a frame described by p, or -1 if
+// the number of lines is not known in advance.
+func frameSize(p *Parameters) int {
+	if p.Lines < 0 {
+		return -1
+	}
+	return int(p.BytesPerLine) * int(p.Lines)
+}
+
+// EstimateMemory estimates the number of bytes of image data a scan of h
+// with the current settings will produce, so that an application can warn
+// before scanning a large area at a high resolution. It is computed from the
+// parameters reported by GetParameters; when the number of lines is not
+// known in advance, it is predicted from the height of the scan area and the
+// resolution. The three frames of a three-pass color scan are counted.
+func EstimateMemory(h SHandle) (bytes int64, err error) {
+	p, err := GetParameters(h)
+	if err != nil {
+		return 0, err
+	}
+	lines := int64(p.Lines)
+	if lines < 0 {
+		top, _, err := getFloatOption(h, NameScanTLY)
+		if err != nil {
+			return 0, err
+		}
+		bottom, _, err := getFloatOption(h, NameScanBRY)
+		if err != nil {
+			return 0, err
+		}
+		dpi, _, err := getFloatOption(h, NameScanResolution)
+		if err != nil {
+			return 0, err
+		}
+		lines = int64(MMToPixels(bottom-top, dpi))
+	}
+	bytes = int64(p.BytesPerLine) * lines
+	switch p.Format {
+	case FrameRed, FrameGreen, FrameBlue:
+		bytes *= 3
+	}
+	return bytes, nil
+}
+
+// readFrame reads the current frame of h until Eof. The data read before an
+// error is returned along with it. In non-blocking mode, readFrame waits for
+// data to become available until ctx is done.
+func readFrame(ctx context.Context, h SHandle, p *Parameters) ([]byte, error) {
+	var data []byte
+	if size := frameSize(p); size > 0 {
+		data = make([]byte, 0, size)
+	}
+	buf := make([]byte, chunkSize(h, readChunkSize))
+	for {
+		n, err := Read(h, buf)
+		addReadStats(h, n)
+		data = append(data, buf[:n]...)
+		if err == Eof {
+			return data, nil
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return data, ctx.Err()
+			}
+			return data, err
+		}
+		if n == 0 {
+			select {
+			case <-ctx.Done():
+				return data, ctx.Err()
+			case <-time.After(pollInterval):
+			}
+		}
+	}
+}
+
+// ReadFull reads exactly len(buf) bytes of the current frame of h into buf,
+// accumulating across short reads, like io.ReadFull. Eof is returned only if
+// no bytes were read; if the frame ends after some but not all of buf was
+// filled, io.ErrUnexpectedEOF is returned.
+func ReadFull(h SHandle, buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		m, err := Read(h, buf[n:])
+		n += m
+		if err == Eof {
+			if n == 0 {
+				return 0, Eof
+			}
+			if n < len(buf) {
+				return n, io.ErrUnexpectedEOF
+			}
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ReadAll reads the current frame of h until Eof and returns its data, like
+// io.ReadAll. The buffer is preallocated from the frame size reported by
+// GetParameters when it is known. On error, the data read so far is returned
+// along with it.
+func ReadAll(h SHandle) ([]byte, error) {
+	p, err := GetParameters(h)
+	if err != nil {
+		return nil, err
+	}
+	return readFrame(context.Background(), h, p)
+}
+
+// decodeFrame assembles the raw data of a frame into an image. Frames of a
+// single channel (FrameGray, FrameRed, FrameGreen and FrameBlue) are decoded
+// as gray images. If p.Lines is unknown, the number of lines is derived from
+// the length of data. ErrEmptyFrame is returned if data is empty.
+func decodeFrame(p *Parameters, data []byte) (image.Image, error) {
+	if len(data) == 0 {
+		return nil, ErrEmptyFrame
+	}
+	bpl, width := int(p.BytesPerLine), int(p.PixelsPerLine)
+	if bpl <= 0 || width <= 0 {
+		return nil, Inval
+	}
+	lines := int(p.Lines)
+	if lines < 0 {
+		lines = len(data) / bpl
+	}
+	if len(data) < lines*bpl {
+		return nil, Inval
+	}
+	rect := image.Rect(0, 0, width, lines)
+	gray := p.Format != FrameRGB
+	bits := sampleBits(p.Depth)
+
+	switch {
+	case gray && bits == 1:
+		img := image.NewGray(rect)
+		for y := 0; y < lines; y++ {
+			row := data[y*bpl:]
+			for x := 0; x < width; x++ {
+				if row[x/8]&(0x80>>uint(x%8)) == 0 {
+					img.Pix[y*img.Stride+x] = 0xff
+				}
+			}
+		}
+		return img, nil
+
+	case gray && bits == 8:
+		img := image.NewGray(rect)
+		for y := 0; y < lines; y++ {
+			copy(img.Pix[y*img.Stride:y*img.Stride+width], data[y*bpl:])
+		}
+		return img, nil
+
+	case gray && bits == 16:
+		sample := sampleScaler(p.Depth)
+		img := image.NewGray16(rect)
+		for y := 0; y < lines; y++ {
+			row := data[y*bpl:]
+			for x := 0; x < width; x++ {
+				binary.BigEndian.PutUint16(img.Pix[y*img.Stride+2*x:], sample(row[2*x:]))
+			}
+		}
+		return img, nil
+
+	case p.Format == FrameRGB && bits == 8:
+		img := image.NewRGBA(rect)
+		for y := 0; y < lines; y++ {
+			row := data[y*bpl:]
+			pix := img.Pix[y*img.Stride:]
+			for x := 0; x < width; x++ {
+				copy(pix[4*x:4*x+3], row[3*x:3*x+3])
+				pix[4*x+3] = 0xff
+			}
+		}
+		return img, nil
+
+	case p.Format == FrameRGB && bits == 16:
+		sample := sampleScaler(p.Depth)
+		img := image.NewRGBA64(rect)
+		for y := 0; y < lines; y++ {
+			row := data[y*bpl:]
+			pix := img.Pix[y*img.Stride:]
+			for x := 0; x < width; x++ {
+				for c := 0; c < 3; c++ {
+					binary.BigEndian.PutUint16(pix[8*x+2*c:], sample(row[6*x+2*c:]))
+				}
+				pix[8*x+6], pix[8*x+7] = 0xff, 0xff
+			}
+		}
+		return img, nil
+	}
+	return nil, Unsupported
+}
+
+// PixelAt returns the pixel at (x, y) of the raw data of a frame described
+// by p, without decoding the whole frame, e.g. to sample a few pixels for
+// white-point detection. The color is as in the image decodeFrame would
+// return: color.Gray or color.Gray16 for single channel frames, and
+// color.RGBA or color.RGBA64 for FrameRGB frames. An error wrapping Inval is
+// returned if p is invalid or (x, y) lies outside the frame or data, and
+// Unsupported for FrameRGB frames of depth 1.
+func PixelAt(p *Parameters, data []byte, x, y int) (color.Color, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	bpl, width, lines := int(p.BytesPerLine), int(p.PixelsPerLine), int(p.Lines)
+	if lines < 0 {
+		lines = len(data) / bpl
+	}
+	if x < 0 || x >= width || y < 0 || y >= lines {
+		return nil, fmt.Errorf("gosane: pixel (%d, %d) outside %dx%d frame: %w", x, y, width, lines, Inval)
+	}
+	spp := 1
+	if p.Format == FrameRGB {
+		spp = 3
+	}
+	bits := sampleBits(p.Depth)
+	if end := y*bpl + ((x+1)*spp*bits+7)/8; len(data) < end {
+		return nil, fmt.Errorf("gosane: pixel (%d, %d) beyond the %d bytes of data: %w", x, y, len(data), Inval)
+	}
+	row := data[y*bpl:]
+
+	switch {
+	case spp == 1 && bits == 1:
+		if row[x/8]&(0x80>>uint(x%8)) == 0 {
+			return color.Gray{0xff}, nil
+		}
+		return color.Gray{0}, nil
+	case spp == 1 && bits == 8:
+		return color.Gray{row[x]}, nil
+	case spp == 1 && bits == 16:
+		return color.Gray16{sampleScaler(p.Depth)(row[2*x:])}, nil
+	case bits == 8:
+		return color.RGBA{row[3*x], row[3*x+1], row[3*x+2], 0xff}, nil
+	case bits == 16:
+		sample := sampleScaler(p.Depth)
+		return color.RGBA64{sample(row[6*x:]), sample(row[6*x+2:]), sample(row[6*x+4:]), 0xffff}, nil
+	}
+	return nil, Unsupported
+}
+
+// decodeChannelFrame decodes the data of a single channel frame of a
+// three-pass color scan, whose format p.Format must be frame (FrameRed,
+// FrameGreen or FrameBlue), as a gray image of that channel. Only depth 1
+// and 8 are supported.
+func decodeChannelFrame(p *Parameters, data []byte, frame Frame) (*image.Gray, error) {
+	switch frame {
+	case FrameRed, FrameGreen, FrameBlue:
+	default:
+		return nil, Inval
+	}
+	if p.Format != frame {
+		return nil, Inval
+	}
+	if p.Depth != 1 && p.Depth != 8 {
+		return nil, Unsupported
+	}
+	img, err := decodeFrame(p, data)
+	if err != nil {
+		return nil, err
+	}
+	return img.(*image.Gray), nil
+}
+
+// EncodeFrame converts img to the raw data of a frame described by p, the
+// inverse of the decoding done by ScanImage: lines are padded to
+// p.BytesPerLine, depth 1 samples are packed with 1 meaning black and depth
+// 16 samples are in host byte order. img must be p.PixelsPerLine wide and,
+// unless p.Lines is -1, p.Lines high.
+func EncodeFrame(p *Parameters, img image.Image) ([]byte, error) {
+	b := img.Bounds()
+	bpl, width, lines := int(p.BytesPerLine), int(p.PixelsPerLine), b.Dy()
+	if b.Dx() != width || (p.Lines >= 0 && int(p.Lines) != lines) {
+		return nil, Inval
+	}
+	spp := 1
+	if p.Format == FrameRGB {
+		spp = 3
+	} else if p.Format != FrameGray {
+		return nil, Unsupported
+	}
+	switch p.Depth {
+	case 1, 8, 16:
+	default:
+		return nil, Unsupported
+	}
+	if bpl*8 < width*spp*int(p.Depth) {
+		return nil, Inval
+	}
+
+	data := make([]byte, bpl*lines)
+	for y := 0; y < lines; y++ {
+		row := data[y*bpl:]
+		for x := 0; x < width; x++ {
+			c := img.At(b.Min.X+x, b.Min.Y+y)
+			if spp == 1 {
+				c = color.Gray16Model.Convert(c)
+			}
+			r, g, bl, _ := c.RGBA()
+			samples := [3]uint32{r, g, bl}
+			for i := 0; i < spp; i++ {
+				s, j := samples[i], x*spp+i
+				switch p.Depth {
+				case 1:
+					if s < 0x8000 {
+						row[j/8] |= 0x80 >> uint(j%8)
+					}
+				case 8:
+					row[j] = byte(s >> 8)
+				case 16:
+					hostByteOrder.PutUint16(row[2*j:], uint16(s))
+				}
+			}
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,418 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestSampleScaler(t *testing.T) {
+	defer SetSampleJustify(SampleJustifyRight)
+	for _, c := range []struct {
+		j          SampleJustify
+		word, want uint16
+	}{
+		{SampleJustifyRight, 0x0fff, 0x0fff},
+		{SampleJustifyRight, 0x0800, 0x0800},
+		{SampleJustifyRight, 0xf123, 0x0123}, // stray high bits are masked
+		{SampleJustifyLeft, 0xfff0, 0xffff},
+		{SampleJustifyLeft, 0x8000, 0x8008},
+		{SampleJustifyLeft, 0x000f, 0x0000}, // stray low bits are dropped
+	} {
+		SetSampleJustify(c.j)
+		b := make([]byte, 2)
+		hostByteOrder.PutUint16(b, c.word)
+		if got := sampleScaler(12)(b); got != c.want {
+			t.Errorf("justify %d: sample %#04x decoded as %#04x, want %#04x", c.j, c.word, got, c.want)
+		}
+	}
+}
+
+func TestEncodeFrameRoundTrip(t *testing.T) {
+	lineart := image.NewGray(image.Rect(0, 0, 17, 4))
+	gray := image.NewGray(image.Rect(0, 0, 17, 4))
+	rgb := image.NewRGBA(image.Rect(0, 0, 17, 4))
+	for i := range gray.Pix {
+		gray.Pix[i] = byte(i * 13)
+		if i%3 == 0 {
+			lineart.Pix[i] = 0xff
+		}
+	}
+	for i := range rgb.Pix {
+		rgb.Pix[i] = byte(i * 7)
+		if i%4 == 3 {
+			rgb.Pix[i] = 0xff
+		}
+	}
+	for _, c := range []struct {
+		name string
+		p    Parameters
+		img  image.Image
+	}{
+		{"lineart", Parameters{Format: FrameGray, BytesPerLine: 3, PixelsPerLine: 17, Lines: 4, Depth: 1}, lineart},
+		{"gray", Parameters{Format: FrameGray, BytesPerLine: 20, PixelsPerLine: 17, Lines: 4, Depth: 8}, gray},
+		{"rgb", Parameters{Format: FrameRGB, BytesPerLine: 52, PixelsPerLine: 17, Lines: 4, Depth: 8}, rgb},
+	} {
+		data, err := EncodeFrame(&c.p, c.img)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if len(data) != int(c.p.BytesPerLine*c.p.Lines) {
+			t.Errorf("%s: encoded %d bytes, want %d", c.name, len(data), c.p.BytesPerLine*c.p.Lines)
+		}
+		img, err := decodeFrame(&c.p, data)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if !reflect.DeepEqual(img, c.img) {
+			t.Errorf("%s: image changed by a round trip through EncodeFrame", c.name)
+		}
+	}
+
+	p := Parameters{Format: FrameGray, BytesPerLine: 16, PixelsPerLine: 16, Lines: 4, Depth: 8}
+	if _, err := EncodeFrame(&p, gray); err != Inval {
+		t.Errorf("EncodeFrame of a mismatched image = %v, want Inval", err)
+	}
+}
+
+func TestParametersValidate(t *testing.T) {
+	good := Parameters{Format: FrameRGB, BytesPerLine: 30, PixelsPerLine: 10, Lines: 4, Depth: 8}
+	if err := good.Validate(); err != nil {
+		t.Fatalf("valid parameters: %v", err)
+	}
+	for _, c := range []struct {
+		name string
+		set  func(p *Parameters)
+	}{
+		{"zero stride", func(p *Parameters) { p.BytesPerLine = 0 }},
+		{"negative stride", func(p *Parameters) { p.BytesPerLine = -30 }},
+		{"zero pixels", func(p *Parameters) { p.PixelsPerLine = 0 }},
+		{"zero lines", func(p *Parameters) { p.Lines = 0 }},
+		{"negative lines", func(p *Parameters) { p.Lines = -2 }},
+		{"depth 4", func(p *Parameters) { p.Depth = 4 }},
+		{"depth 32", func(p *Parameters) { p.Depth = 32 }},
+		{"unknown format", func(p *Parameters) { p.Format = 9 }},
+		{"short stride", func(p *Parameters) { p.BytesPerLine = 29 }},
+		{"depth too large for stride", func(p *Parameters) { p.Depth = 16 }},
+	} {
+		p := good
+		c.set(&p)
+		if err := p.Validate(); !errors.Is(err, Inval) {
+			t.Errorf("%s: Validate = %v, want Inval", c.name, err)
+		}
+	}
+
+	p := good
+	p.Lines = -1
+	if err := p.Validate(); err != nil {
+		t.Errorf("unknown line count: %v", err)
+	}
+
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	defer Exit()
+	f.params.BytesPerLine = 0
+	if img, err := ScanImage(h); img != nil || !errors.Is(err, Inval) {
+		t.Errorf("ScanImage with a zero stride = %v, %v; want Inval", img, err)
+	}
+}
+
+func TestReadFullShortReads(t *testing.T) {
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	defer Exit()
+	// A backend returning a single byte per Read.
+	f.chunk = 1
+
+	if err := Start(h); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if n, err := ReadFull(h, buf); n != 5 || err != nil || !bytes.Equal(buf, f.data[:5]) {
+		t.Fatalf("ReadFull = %d, %v, %v", n, err, buf)
+	}
+	if n, err := ReadFull(h, buf); n != 3 || err != io.ErrUnexpectedEOF || !bytes.Equal(buf[:n], f.data[5:]) {
+		t.Errorf("ReadFull past the end = %d, %v; want 3, io.ErrUnexpectedEOF", n, err)
+	}
+	if n, err := ReadFull(h, buf); n != 0 || err != Eof {
+		t.Errorf("ReadFull at the end = %d, %v; want 0, Eof", n, err)
+	}
+	Cancel(h)
+
+	img, err := ScanImage(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, ok := img.(*image.Gray); !ok || !bytes.Equal(g.Pix, f.data) {
+		t.Errorf("ScanImage from 1-byte reads = %v", img)
+	}
+}
+
+func TestReadAll(t *testing.T) {
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	defer Exit()
+	f.params = Parameters{Format: FrameRGB, LastFrame: STRUE, BytesPerLine: 12, PixelsPerLine: 4, Lines: 10, Depth: 8}
+	f.data = make([]byte, 12*10)
+	f.chunk = 7
+
+	if err := Start(h); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ReadAll(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 120 || cap(data) != 120 {
+		t.Errorf("ReadAll returned %d bytes with capacity %d, want 120 preallocated", len(data), cap(data))
+	}
+	Cancel(h)
+
+	// Without a known line count, the buffer grows as needed.
+	f.params.Lines = -1
+	f.data = make([]byte, 12*33)
+	Start(h)
+	if data, err := ReadAll(h); len(data) != 12*33 || err != nil {
+		t.Errorf("ReadAll of unknown length = %d bytes, %v; want %d", len(data), err, 12*33)
+	}
+	Cancel(h)
+
+	f.readErr = IoError
+	Start(h)
+	if data, err := ReadAll(h); len(data) != 12*33 || err != IoError {
+		t.Errorf("failing ReadAll = %d bytes, %v; want the data read and IoError", len(data), err)
+	}
+}
+
+func TestScanImageRGB16(t *testing.T) {
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	defer Exit()
+	// 3x2 pixels, with 4 bytes of padding at the end of each line.
+	const width, lines, bpl = 3, 2, 3*6 + 4
+	f.params = Parameters{Format: FrameRGB, LastFrame: STRUE, BytesPerLine: bpl, PixelsPerLine: width, Lines: lines, Depth: 16}
+	f.data = make([]byte, bpl*lines)
+	sample := func(x, y, c int) uint16 { return uint16(0x0101*(y*width+x)) + uint16(c)<<14 + 1 }
+	for y := 0; y < lines; y++ {
+		for x := 0; x < width; x++ {
+			for c := 0; c < 3; c++ {
+				hostByteOrder.PutUint16(f.data[y*bpl+6*x+2*c:], sample(x, y, c))
+			}
+		}
+		copy(f.data[y*bpl+6*width:], []byte{0xde, 0xad, 0xbe, 0xef})
+	}
+
+	img, err := ScanImage(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rgba, ok := img.(*image.RGBA64)
+	if !ok || rgba.Bounds() != image.Rect(0, 0, width, lines) {
+		t.Fatalf("ScanImage returned %T %v, want a %dx%d *image.RGBA64", img, img.Bounds(), width, lines)
+	}
+	for y := 0; y < lines; y++ {
+		for x := 0; x < width; x++ {
+			want := color.RGBA64{sample(x, y, 0), sample(x, y, 1), sample(x, y, 2), 0xffff}
+			if got := rgba.RGBA64At(x, y); got != want {
+				t.Errorf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestEstimateMemory(t *testing.T) {
+	f := newFakeBackend()
+	f.option(NameScanResolution).desc.Constraint = WordListConstraint{75, 150, 300, 600}
+	// Color parameters following the resolution and scan area.
+	f.onSet = func(n SInt) Info {
+		mm := func(name SStringConst) float64 { return FixedToFloat(SFixed(f.option(name).words[0])) }
+		dpi := float64(f.option(NameScanResolution).words[0])
+		w := MMToPixels(mm(NameScanBRX)-mm(NameScanTLX), dpi)
+		f.params = Parameters{Format: FrameRGB, BytesPerLine: SInt(3 * w), PixelsPerLine: SInt(w), Depth: 8,
+			Lines: SInt(MMToPixels(mm(NameScanBRY)-mm(NameScanTLY), dpi))}
+		return ReloadParams
+	}
+	h := setupFake(t, f)
+	defer Exit()
+	if err := SetOptions(h, map[string]string{"resolution": "600", "br-x": "210", "br-y": "297"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A4 is 4961 by 7016 pixels at 600 dpi, of 3 bytes each.
+	const want = 4961 * 3 * 7016
+	n, err := EstimateMemory(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n < want*99/100 || n > want*101/100 {
+		t.Errorf("A4 at 600 dpi estimated at %d bytes, want about %d", n, want)
+	}
+
+	// Predicted when the backend does not know the number of lines.
+	f.params.Lines = -1
+	if m, err := EstimateMemory(h); err != nil || m != n {
+		t.Errorf("estimate with unknown lines = %d, %v; want %d", m, err, n)
+	}
+
+	// Three-pass scans produce three frames.
+	f.params.Format, f.params.BytesPerLine = FrameRed, f.params.PixelsPerLine
+	if m, err := EstimateMemory(h); err != nil || m != n {
+		t.Errorf("three-pass estimate = %d, %v; want %d", m, err, n)
+	}
+}
+
+func TestIsLastFrame(t *testing.T) {
+	for _, c := range []struct {
+		v    SBool
+		want bool
+	}{{SFALSE, false}, {STRUE, true}, {2, true}, {-1, true}} {
+		p := Parameters{LastFrame: c.v}
+		if got := p.IsLastFrame(); got != c.want {
+			t.Errorf("IsLastFrame with LastFrame %d = %v, want %v", c.v, got, c.want)
+		}
+	}
+}
+
+// threePass makes f scan frames of a three-pass color scan: each Start
+// begins the next of frames, whose data is that of the matching plane.
+func threePass(f *fakeBackend, frames []Parameters, planes [][]byte) {
+	f.onStart = func() error {
+		if len(frames) == 0 {
+			return NoDocs
+		}
+		f.params, frames = frames[0], frames[1:]
+		f.data, planes = planes[0], planes[1:]
+		return nil
+	}
+}
+
+func TestScanColorImageThreePass(t *testing.T) {
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	defer Exit()
+	p := Parameters{BytesPerLine: 2, PixelsPerLine: 2, Lines: 2, Depth: 8}
+	var frames []Parameters
+	// Frames may come in any order; the last must say so.
+	for i, fr := range []Frame{FrameGreen, FrameBlue, FrameRed} {
+		p.Format, p.LastFrame = fr, SFALSE
+		if i == 2 {
+			p.LastFrame = STRUE
+		}
+		frames = append(frames, p)
+	}
+	threePass(f, frames, [][]byte{{20, 21, 22, 23}, {30, 31, 32, 33}, {10, 11, 12, 13}})
+
+	img, err := ScanColorImage(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rgba, ok := img.(*image.RGBA)
+	if !ok || rgba.Bounds() != image.Rect(0, 0, 2, 2) {
+		t.Fatalf("ScanColorImage returned %T %v, want a 2x2 *image.RGBA", img, img.Bounds())
+	}
+	for i := 0; i < 4; i++ {
+		want := color.RGBA{uint8(10 + i), uint8(20 + i), uint8(30 + i), 0xff}
+		if got := rgba.RGBAAt(i%2, i/2); got != want {
+			t.Errorf("pixel (%d, %d) = %v, want %v", i%2, i/2, got, want)
+		}
+	}
+}
+
+func TestDecodeChannelFrame(t *testing.T) {
+	data := []byte{5, 6, 7, 8}
+	for _, fr := range []Frame{FrameRed, FrameGreen, FrameBlue} {
+		p := &Parameters{Format: fr, BytesPerLine: 2, PixelsPerLine: 2, Lines: 2, Depth: 8}
+		g, err := decodeChannelFrame(p, data, fr)
+		if err != nil {
+			t.Errorf("frame %d: %v", fr, err)
+			continue
+		}
+		if g.Rect != image.Rect(0, 0, 2, 2) || !bytes.Equal(g.Pix, data) {
+			t.Errorf("frame %d decoded to %v %v, want %v", fr, g.Rect, g.Pix, data)
+		}
+	}
+	p := &Parameters{Format: FrameRed, BytesPerLine: 2, PixelsPerLine: 2, Lines: 2, Depth: 8}
+	if _, err := decodeChannelFrame(p, data, FrameBlue); err != Inval {
+		t.Errorf("decoding a red frame as blue = %v, want Inval", err)
+	}
+	p.Format = FrameGray
+	if _, err := decodeChannelFrame(p, data, FrameGray); err != Inval {
+		t.Errorf("decoding a gray frame = %v, want Inval", err)
+	}
+}
+
+func TestScanColorImageFrameMismatch(t *testing.T) {
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	defer Exit()
+	p := Parameters{Format: FrameRed, BytesPerLine: 2, PixelsPerLine: 2, Lines: 2, Depth: 8}
+	q := p
+	q.Format, q.BytesPerLine = FrameGreen, 3
+	threePass(f, []Parameters{p, q}, [][]byte{{1, 2, 3, 4}, {1, 2, 3, 4, 5, 6}})
+
+	_, err := ScanColorImage(h)
+	var fm *FrameMismatch
+	if !errors.As(err, &fm) {
+		t.Fatalf("ScanColorImage = %v, want a *FrameMismatch", err)
+	}
+	if want := (FrameMismatch{Frame: 1, Field: "BytesPerLine", Want: 2, Got: 3}); *fm != want {
+		t.Errorf("mismatch %+v, want %+v", *fm, want)
+	}
+
+	// Neither can a later frame switch to a single pass format.
+	q = p
+	q.Format = FrameGray
+	threePass(f, []Parameters{p, q}, [][]byte{{1, 2, 3, 4}, {1, 2, 3, 4}})
+	if _, err := ScanColorImage(h); !errors.As(err, &fm) || fm.Field != "Format" {
+		t.Errorf("ScanColorImage = %v, want a Format mismatch", err)
+	}
+}
+
+func TestPixelAt(t *testing.T) {
+	for _, fr := range fastFrames {
+		data := make([]byte, fr.size)
+		for i := range data {
+			data[i] = byte(i*37 + 11)
+		}
+		p := fr.params
+		img, err := decodeFrame(&p, data)
+		if err != nil {
+			t.Fatalf("%s: %v", fr.name, err)
+		}
+		b := img.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c, err := PixelAt(&p, data, x, y)
+				if err != nil {
+					t.Fatalf("%s: PixelAt(%d, %d): %v", fr.name, x, y, err)
+				}
+				if want := img.At(x, y); c != want {
+					t.Errorf("%s: PixelAt(%d, %d) = %v, want %v", fr.name, x, y, c, want)
+				}
+			}
+		}
+		for _, pt := range []image.Point{{-1, 0}, {0, -1}, {b.Max.X, 0}, {0, b.Max.Y}} {
+			if _, err := PixelAt(&p, data, pt.X, pt.Y); !errors.Is(err, Inval) {
+				t.Errorf("%s: PixelAt%v = %v, want Inval", fr.name, pt, err)
+			}
+		}
+	}
+
+	// A truncated frame has no pixels beyond its data.
+	p := Parameters{Format: FrameRGB, BytesPerLine: 6, PixelsPerLine: 2, Lines: 2, Depth: 8}
+	data := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}
+	if c, err := PixelAt(&p, data, 0, 1); err != nil || c != (color.RGBA{7, 8, 9, 0xff}) {
+		t.Errorf("PixelAt(0, 1) = %v, %v", c, err)
+	}
+	if _, err := PixelAt(&p, data, 1, 1); !errors.Is(err, Inval) {
+		t.Errorf("PixelAt beyond the data = %v, want Inval", err)
+	}
+}
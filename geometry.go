@@ -0,0 +1,204 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"image"
+	"math"
+)
+
+const mmPerInch = 25.4
+
+// PixelsToMM converts a length of px pixels at dpi to mm, e.g. to set the
+// geometry options from a selection made on an image.
+func PixelsToMM(px int, dpi float64) float64 {
+	return float64(px) * mmPerInch / dpi
+}
+
+// MMToPixels converts a length in mm to pixels at dpi, rounding half up, so
+// that e.g. the 210 mm width of A4 is 2480 pixels at 300 dpi.
+func MMToPixels(mm, dpi float64) int {
+	return int(math.Floor(mm*dpi/mmPerInch + 0.5))
+}
+
+// clampToRange clamps v to the range constraint of d, if it has one.
+func clampToRange(d *OptionDescriptor, v float64) float64 {
+	min, max, _, ok := d.RangeInfo()
+	if !ok {
+		return v
+	}
+	return math.Max(min, math.Min(max, v))
+}
+
+// setScanArea sets the geometry options of h to the given area in mm, after
+// clamping each coordinate to its option's range. The values actually applied
+// by the backend are returned.
+//
+// On each axis the bottom-right coordinate is set first when the area moves
+// past it, so that the top-left corner never passes the bottom-right one,
+// which some backends reject.
+func setScanArea(h SHandle, tlx, tly, brx, bry float64) (float64, float64, float64, float64, error) {
+	axes := []struct {
+		tl, br   SStringConst
+		tlv, brv *float64
+	}{
+		{NameScanTLX, NameScanBRX, &tlx, &brx},
+		{NameScanTLY, NameScanBRY, &tly, &bry},
+	}
+	for _, a := range axes {
+		cur, _, err := getFloatOption(h, a.br)
+		if err != nil {
+			return 0, 0, 0, 0, err
+		}
+		order := []struct {
+			name SStringConst
+			v    *float64
+		}{{a.tl, a.tlv}, {a.br, a.brv}}
+		if *a.tlv > cur {
+			order[0], order[1] = order[1], order[0]
+		}
+		for _, c := range order {
+			_, d, err := FindOption(h, c.name)
+			if err != nil {
+				return 0, 0, 0, 0, err
+			}
+			v, _, err := setFloatOption(h, c.name, clampToRange(d, *c.v))
+			if err != nil {
+				return 0, 0, 0, 0, err
+			}
+			*c.v = v
+		}
+	}
+	return tlx, tly, brx, bry, nil
+}
+
+// SetScanAreaPixels sets the scan area of h to the width by height pixel
+// rectangle at x, y, converting to mm using the current resolution. The area
+// is clamped to the maximum area of the device and the clamped region is
+// returned, in pixels.
+func SetScanAreaPixels(h SHandle, x, y, width, height int) (image.Rectangle, error) {
+	dpi, _, err := getFloatOption(h, NameScanResolution)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	if dpi <= 0 {
+		return image.Rectangle{}, Inval
+	}
+	tlx, tly, brx, bry, err := setScanArea(h,
+		PixelsToMM(x, dpi), PixelsToMM(y, dpi),
+		PixelsToMM(x+width, dpi), PixelsToMM(y+height, dpi))
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	return image.Rect(MMToPixels(tlx, dpi), MMToPixels(tly, dpi), MMToPixels(brx, dpi), MMToPixels(bry, dpi)), nil
+}
+
+// MaxArea returns the largest scan area of h, i.e. the size of its scan bed,
+// in mm, from the ranges of its geometry options. GUIs use it to scale
+// previews. Unsupported is returned if the device lacks any of the geometry
+// options or they are not constrained by ranges.
+func MaxArea(h SHandle) (tlxMM, tlyMM, brxMM, bryMM float64, err error) {
+	bounds := []struct {
+		name SStringConst
+		max  bool
+		v    *float64
+	}{
+		{NameScanTLX, false, &tlxMM},
+		{NameScanTLY, false, &tlyMM},
+		{NameScanBRX, true, &brxMM},
+		{NameScanBRY, true, &bryMM},
+	}
+	for _, b := range bounds {
+		_, d, err := FindOption(h, b.name)
+		if err != nil {
+			return 0, 0, 0, 0, err
+		}
+		min, max, _, ok := d.RangeInfo()
+		if !ok {
+			return 0, 0, 0, 0, Unsupported
+		}
+		if b.max {
+			*b.v = max
+		} else {
+			*b.v = min
+		}
+	}
+	return tlxMM, tlyMM, brxMM, bryMM, nil
+}
+
+// SetMaxScanArea sets the scan area of h to the whole scan bed. Devices
+// without geometry options always scan their whole area, so nil is returned
+// for them.
+func SetMaxScanArea(h SHandle) error {
+	tlx, tly, brx, bry, err := MaxArea(h)
+	if err == Unsupported {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, _, _, _, err = setScanArea(h, tlx, tly, brx, bry)
+	return err
+}
+
+// SetScanAreaFromPreview sets the scan area of h from a selection made on a
+// preview of the whole scan bed that is previewW by previewH pixels. The
+// selection, selW by selH pixels at selX, selY, is clamped to the preview
+// and mapped onto the bed in mm, scaling each axis independently so a
+// preview with a different aspect ratio than the bed still maps correctly.
+// Selecting the whole preview selects the whole bed.
+func SetScanAreaFromPreview(h SHandle, previewW, previewH, selX, selY, selW, selH int) error {
+	if previewW <= 0 || previewH <= 0 {
+		return Inval
+	}
+	sel := image.Rect(selX, selY, selX+selW, selY+selH).Intersect(image.Rect(0, 0, previewW, previewH))
+	if sel.Empty() {
+		return Inval
+	}
+	tlx, tly, brx, bry, err := MaxArea(h)
+	if err != nil {
+		return err
+	}
+	sx, sy := (brx-tlx)/float64(previewW), (bry-tly)/float64(previewH)
+	_, _, _, _, err = setScanArea(h,
+		tlx+float64(sel.Min.X)*sx, tly+float64(sel.Min.Y)*sy,
+		tlx+float64(sel.Max.X)*sx, tly+float64(sel.Max.Y)*sy)
+	return err
+}
+
+// PaperSize is the size of a sheet of paper, in mm.
+type PaperSize struct {
+	Width, Height float64
+}
+
+// Common paper sizes.
+var (
+	PaperA4     = PaperSize{Width: 210, Height: 297}
+	PaperLetter = PaperSize{Width: 215.9, Height: 279.4}
+	PaperLegal  = PaperSize{Width: 215.9, Height: 355.6}
+)
+
+// SetPageSize tells the document feeder of h the size of the paper loaded,
+// through the page-width and page-height options of sheet-fed scanners.
+// These are separate from the scan area. Unsupported is returned, and
+// neither option is set, if the device does not have both options.
+func SetPageSize(h SHandle, widthMM, heightMM float64) error {
+	for _, name := range []SStringConst{NamePageWidth, NamePageHeight} {
+		if _, _, err := FindOption(h, name); err != nil {
+			return err
+		}
+	}
+	if _, _, err := setFloatOption(h, NamePageWidth, widthMM); err != nil {
+		return err
+	}
+	_, _, err := setFloatOption(h, NamePageHeight, heightMM)
+	return err
+}
+
+// SetPageSizeStandard is like SetPageSize, for a standard paper size such as
+// PaperA4.
+func SetPageSizeStandard(h SHandle, size PaperSize) error {
+	return SetPageSize(h, size.Width, size.Height)
+}
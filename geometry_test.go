@@ -0,0 +1,210 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"image"
+	"testing"
+)
+
+// pageSizeOption describes a page-width or page-height option.
+func pageSizeOption(name SStringConst) OptionDescriptor {
+	return OptionDescriptor{Name: name, Type: TypeFixed, Unit: UnitMm, Size: 4, Cap: SoftSelect | SoftDetect,
+		Constraint: RangeConstraint{SRange{Max: SWord(FloatToFixed(500))}}}
+}
+
+func TestSetPageSize(t *testing.T) {
+	f := newFakeBackend()
+	f.addOption(pageSizeOption(NamePageWidth), SWord(0))
+	f.addOption(pageSizeOption(NamePageHeight), SWord(0))
+	h := setupFake(t, f)
+	defer Exit()
+
+	if err := SetPageSizeStandard(h, PaperA4); err != nil {
+		t.Fatal(err)
+	}
+	w := SFixed(f.option(NamePageWidth).words[0]).Round(1)
+	ht := SFixed(f.option(NamePageHeight).words[0]).Round(1)
+	if w != 210 || ht != 297 {
+		t.Errorf("page size set to %vx%v mm, want 210x297", w, ht)
+	}
+}
+
+func TestSetPageSizeMissingHeight(t *testing.T) {
+	f := newFakeBackend()
+	f.addOption(pageSizeOption(NamePageWidth), SWord(0))
+	h := setupFake(t, f)
+	defer Exit()
+
+	if err := SetPageSize(h, 210, 297); err != Unsupported {
+		t.Errorf("SetPageSize = %v, want Unsupported", err)
+	}
+	if w := f.option(NamePageWidth).words[0]; w != 0 {
+		t.Errorf("page-width set to %v without a page-height option", FixedToFloat(SFixed(w)))
+	}
+}
+
+// watchArea makes f report through the returned function whether the
+// top-left corner of the scan area ever passed the bottom-right one.
+func watchArea(f *fakeBackend) func() bool {
+	crossed := false
+	f.onSet = func(n SInt) Info {
+		word := func(name SStringConst) SWord { return f.option(name).words[0] }
+		if word(NameScanTLX) > word(NameScanBRX) || word(NameScanTLY) > word(NameScanBRY) {
+			crossed = true
+		}
+		return 0
+	}
+	return func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return crossed
+	}
+}
+
+func TestSetScanAreaPixels(t *testing.T) {
+	f := newFakeBackend()
+	crossed := watchArea(f)
+	h := setupFake(t, f)
+	defer Exit()
+
+	for _, want := range []image.Rectangle{
+		image.Rect(0, 0, 600, 600),
+		image.Rect(1200, 1500, 2400, 3000), // past the previous area
+		image.Rect(30, 40, 630, 840),       // back before it
+		image.Rect(2000, 3000, 2600, 3600), // clamped to the bed
+	} {
+		got, err := SetScanAreaPixels(h, want.Min.X, want.Min.Y, want.Dx(), want.Dy())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The bed is 215.9x297 mm, 2550x3508 pixels at 300 dpi.
+		want = want.Intersect(image.Rect(0, 0, 2550, 3508))
+		if d := got.Min.Sub(want.Min).Add(got.Max.Sub(want.Max)); d.X < -2 || d.X > 2 || d.Y < -2 || d.Y > 2 {
+			t.Errorf("area set to %v, want %v", got, want)
+		}
+		if crossed() {
+			t.Fatalf("setting %v moved the top-left corner past the bottom-right one", want)
+		}
+	}
+}
+
+// trackArea makes the parameters of f follow its scan area and resolution,
+// as a real backend's do, for 8-bit gray frames.
+func trackArea(f *fakeBackend) {
+	f.onSet = func(n SInt) Info {
+		mm := func(name SStringConst) float64 { return FixedToFloat(SFixed(f.option(name).words[0])) }
+		dpi := float64(f.option(NameScanResolution).words[0])
+		w := MMToPixels(mm(NameScanBRX)-mm(NameScanTLX), dpi)
+		f.params.PixelsPerLine, f.params.BytesPerLine = SInt(w), SInt(w)
+		f.params.Lines = SInt(MMToPixels(mm(NameScanBRY)-mm(NameScanTLY), dpi))
+		return ReloadParams
+	}
+}
+
+func TestSetMaxScanArea(t *testing.T) {
+	f := newFakeBackend()
+	trackArea(f)
+	h := setupFake(t, f)
+	defer Exit()
+
+	if _, err := SetScanAreaPixels(h, 300, 300, 600, 600); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetMaxScanArea(h); err != nil {
+		t.Fatal(err)
+	}
+	p, err := GetParameters(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The 215.9x297 mm bed at 300 dpi.
+	if p.PixelsPerLine != 2550 || p.Lines != 3508 {
+		t.Errorf("parameters after SetMaxScanArea are %dx%d, want 2550x3508", p.PixelsPerLine, p.Lines)
+	}
+	tlx, tly, brx, bry, err := MaxArea(h)
+	if err != nil || tlx != 0 || tly != 0 || brx != FixedToFloat(FloatToFixed(215.9)) || bry != 297 {
+		t.Errorf("MaxArea = %v, %v, %v, %v, %v", tlx, tly, brx, bry, err)
+	}
+}
+
+func TestSetMaxScanAreaNoGeometry(t *testing.T) {
+	f := newFakeBackend()
+	f.opts = f.opts[:3] // option count, resolution and mode
+	f.opts[0].words[0] = 3
+	h := setupFake(t, f)
+	defer Exit()
+
+	if err := SetMaxScanArea(h); err != nil {
+		t.Errorf("SetMaxScanArea without geometry options = %v, want nil", err)
+	}
+	if _, _, _, _, err := MaxArea(h); err == nil {
+		t.Error("MaxArea without geometry options succeeded")
+	}
+}
+
+func TestSetScanAreaFromPreview(t *testing.T) {
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	defer Exit()
+	word := func(name SStringConst) SWord { return f.option(name).words[0] }
+	full := map[SStringConst]SWord{}
+	for _, name := range []SStringConst{NameScanTLX, NameScanTLY, NameScanBRX, NameScanBRY} {
+		full[name] = word(name)
+	}
+	if _, _, _, _, err := setScanArea(h, 10, 20, 100, 120); err != nil {
+		t.Fatal(err)
+	}
+
+	// A preview of another aspect ratio than the bed, selected whole.
+	if err := SetScanAreaFromPreview(h, 400, 300, 0, 0, 400, 300); err != nil {
+		t.Fatal(err)
+	}
+	for name, w := range full {
+		if word(name) != w {
+			t.Errorf("%s = %v after selecting the whole preview, want %v", name, FixedToFloat(SFixed(word(name))), FixedToFloat(SFixed(w)))
+		}
+	}
+
+	// The bottom right quarter, with the selection overflowing the preview.
+	if err := SetScanAreaFromPreview(h, 400, 300, 200, 150, 300, 300); err != nil {
+		t.Fatal(err)
+	}
+	mm := func(name SStringConst) float64 { return SFixed(word(name)).Round(2) }
+	if x, y, bx, by := mm(NameScanTLX), mm(NameScanTLY), mm(NameScanBRX), mm(NameScanBRY); x != 107.95 || y != 148.5 || bx != 215.9 || by != 297 {
+		t.Errorf("quarter selection set %v,%v-%v,%v", x, y, bx, by)
+	}
+
+	if err := SetScanAreaFromPreview(h, 400, 300, 500, 10, 10, 10); err != Inval {
+		t.Errorf("selection outside the preview = %v, want Inval", err)
+	}
+}
+
+func TestMMToPixels(t *testing.T) {
+	for _, c := range []struct {
+		mm, dpi float64
+		want    int
+	}{
+		{210, 300, 2480},
+		{297, 300, 3508},
+		{215.9, 600, 5100},
+		{25.4, 72, 72},
+		{0.254 / 2, 100, 1}, // exactly half a pixel rounds up
+		{0.254 * 0.49, 100, 0},
+		{0, 1200, 0},
+	} {
+		if got := MMToPixels(c.mm, c.dpi); got != c.want {
+			t.Errorf("MMToPixels(%v, %v) = %d, want %d", c.mm, c.dpi, got, c.want)
+		}
+	}
+	for _, px := range []int{0, 1, 2480, 7016} {
+		if got := MMToPixels(PixelsToMM(px, 300), 300); got != px {
+			t.Errorf("%d pixels round-trip to %d", px, got)
+		}
+	}
+	if mm := PixelsToMM(300, 300); mm != 25.4 {
+		t.Errorf("PixelsToMM(300, 300) = %v, want 25.4", mm)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"sync"
+)
+
+var (
+	iccMu      sync.RWMutex
+	iccProfile []byte
+)
+
+// iccHeaderSize is the size of the fixed header of an ICC profile.
+const iccHeaderSize = 128
+
+// SetOutputICCProfile sets the ICC color profile embedded by WritePNG,
+// WriteJPEG and WriteTIFF, e.g. the profile shipped by the scanner vendor.
+// Passing nil restores the default of embedding no profile. An error
+// wrapping Inval is returned, and the current profile kept, if profile does
+// not start with a valid ICC header.
+func SetOutputICCProfile(profile []byte) error {
+	if profile != nil {
+		if len(profile) < iccHeaderSize || string(profile[36:40]) != "acsp" {
+			return fmt.Errorf("gosane: not an ICC profile: %w", Inval)
+		}
+		if size := binary.BigEndian.Uint32(profile); int64(size) != int64(len(profile)) {
+			return fmt.Errorf("gosane: ICC profile is %d bytes, header says %d: %w", len(profile), size, Inval)
+		}
+		profile = append([]byte(nil), profile...)
+	}
+	iccMu.Lock()
+	iccProfile = profile
+	iccMu.Unlock()
+	return nil
+}
+
+func currentICCProfile() []byte {
+	iccMu.RLock()
+	defer iccMu.RUnlock()
+	return iccProfile
+}
+
+// pngInsertICCP returns the PNG file data with an iCCP chunk holding
+// profile inserted after the IHDR chunk, where the PNG specification
+// requires it to come before PLTE and IDAT.
+func pngInsertICCP(data, profile []byte) ([]byte, error) {
+	var body bytes.Buffer
+	body.WriteString("ICC profile\x00")
+	body.WriteByte(0) // zlib
+	zw := zlib.NewWriter(&body)
+	zw.Write(profile)
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return pngInsertChunk(data, "iCCP", body.Bytes())
+}
+
+// pngInsertChunk returns the PNG file data with a chunk of type typ holding
+// body inserted right after the IHDR chunk.
+func pngInsertChunk(data []byte, typ string, body []byte) ([]byte, error) {
+	// The signature, then the length, type, 13 bytes of data and CRC of IHDR.
+	const ihdrEnd = 8 + 4 + 4 + 13 + 4
+	if len(data) < ihdrEnd || string(data[12:16]) != "IHDR" {
+		return nil, Inval
+	}
+	chunk := make([]byte, 8, 12+len(body))
+	binary.BigEndian.PutUint32(chunk, uint32(len(body)))
+	copy(chunk[4:], typ)
+	chunk = append(chunk, body...)
+	chunk = append(chunk, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(chunk[len(chunk)-4:], crc32.ChecksumIEEE(chunk[4:len(chunk)-4]))
+
+	out := make([]byte, 0, len(data)+len(chunk))
+	out = append(out, data[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, data[ihdrEnd:]...), nil
+}
+
+// jpegICCChunk is the largest part of a profile fitting in one APP2 marker
+// segment, after the length, the "ICC_PROFILE" signature and the sequence
+// numbers.
+const jpegICCChunk = 65535 - 2 - 12 - 2
+
+// jpegInsertICC returns the JPEG file data with profile inserted after the
+// SOI marker, split across APP2 marker segments as specified by the ICC.
+func jpegInsertICC(data, profile []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, Inval
+	}
+	count := (len(profile) + jpegICCChunk - 1) / jpegICCChunk
+	if count > 255 {
+		return nil, Inval
+	}
+	out := make([]byte, 0, len(data)+len(profile)+count*18)
+	out = append(out, data[:2]...)
+	for i := 0; i < count; i++ {
+		part := profile[i*jpegICCChunk:]
+		if len(part) > jpegICCChunk {
+			part = part[:jpegICCChunk]
+		}
+		size := 2 + 12 + 2 + len(part)
+		out = append(out, 0xff, 0xe2, byte(size>>8), byte(size))
+		out = append(out, "ICC_PROFILE\x00"...)
+		out = append(out, byte(i+1), byte(count))
+		out = append(out, part...)
+	}
+	return append(out, data[2:]...), nil
+}
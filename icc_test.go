@@ -0,0 +1,103 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"testing"
+)
+
+// testICCProfile returns a made up ICC profile of size bytes.
+func testICCProfile(size int) []byte {
+	p := make([]byte, size)
+	binary.BigEndian.PutUint32(p, uint32(size))
+	copy(p[36:], "acsp")
+	for i := iccHeaderSize; i < size; i++ {
+		p[i] = byte(i)
+	}
+	return p
+}
+
+// pngChunks returns the types and bodies of the chunks of the PNG file data.
+func pngChunks(t *testing.T, data []byte) (types []string, bodies [][]byte) {
+	t.Helper()
+	for data = data[8:]; len(data) >= 12; {
+		n := int(binary.BigEndian.Uint32(data))
+		types = append(types, string(data[4:8]))
+		bodies = append(bodies, data[8:8+n])
+		data = data[12+n:]
+	}
+	return types, bodies
+}
+
+func TestOutputICCProfile(t *testing.T) {
+	defer SetOutputICCProfile(nil)
+	profile := testICCProfile(300)
+	for _, bad := range [][]byte{profile[:100], append(profile[:len(profile):len(profile)], 0), make([]byte, 300)} {
+		if err := SetOutputICCProfile(bad); !errors.Is(err, Inval) {
+			t.Errorf("invalid profile of %d bytes accepted: %v", len(bad), err)
+		}
+	}
+	if err := SetOutputICCProfile(profile); err != nil {
+		t.Fatal(err)
+	}
+	img := image.NewGray(image.Rect(0, 0, 4, 3))
+
+	var buf bytes.Buffer
+	if err := WritePNG(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	types, bodies := pngChunks(t, buf.Bytes())
+	if len(types) < 2 || types[0] != "IHDR" || types[1] != "iCCP" {
+		t.Fatalf("PNG chunks %q, want iCCP after IHDR", types)
+	}
+	name := []byte("ICC profile\x00\x00")
+	if !bytes.HasPrefix(bodies[1], name) {
+		t.Fatalf("iCCP chunk starts with %q", bodies[1][:len(name)])
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(bodies[1][len(name):]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadAll(zr); err != nil || !bytes.Equal(got, profile) {
+		t.Errorf("iCCP chunk holds %d bytes, %v; want the profile", len(got), err)
+	}
+	if _, err := png.Decode(&buf); err != nil {
+		t.Errorf("PNG with a profile does not decode: %v", err)
+	}
+
+	buf.Reset()
+	if err := WriteJPEG(&buf, img, 90); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), append([]byte("ICC_PROFILE\x00\x01\x01"), profile...)) {
+		t.Error("JPEG does not hold the profile")
+	}
+	if _, err := jpeg.Decode(&buf); err != nil {
+		t.Errorf("JPEG with a profile does not decode: %v", err)
+	}
+
+	buf.Reset()
+	if err := WriteTIFF(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), profile) {
+		t.Error("TIFF does not hold the profile")
+	}
+
+	SetOutputICCProfile(nil)
+	buf.Reset()
+	WritePNG(&buf, img)
+	if types, _ := pngChunks(t, buf.Bytes()); types[1] == "iCCP" {
+		t.Error("PNG holds a profile after removing it")
+	}
+}
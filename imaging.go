@@ -0,0 +1,293 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"image"
+	"image/color"
+)
+
+// isGray reports whether img holds gray pixels.
+func isGray(img image.Image) bool {
+	m := img.ColorModel()
+	return m == color.GrayModel || m == color.Gray16Model
+}
+
+// Thumbnail returns an 8-bit copy of img downscaled with a box filter so
+// that its longest side is at most maxDim pixels, preserving the aspect
+// ratio. Images are never upscaled. Gray inputs produce an *image.Gray and
+// all others an *image.RGBA.
+func Thumbnail(img image.Image, maxDim int) image.Image {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	dw, dh := sw, sh
+	if maxDim > 0 && (sw > maxDim || sh > maxDim) {
+		if sw >= sh {
+			dw, dh = maxDim, sh*maxDim/sw
+		} else {
+			dw, dh = sw*maxDim/sh, maxDim
+		}
+		if dw < 1 {
+			dw = 1
+		}
+		if dh < 1 {
+			dh = 1
+		}
+	}
+
+	gray := isGray(img)
+	var dst image.Image
+	var set func(x, y int, c color.Color)
+	if gray {
+		g := image.NewGray(image.Rect(0, 0, dw, dh))
+		dst, set = g, g.Set
+	} else {
+		rgba := image.NewRGBA(image.Rect(0, 0, dw, dh))
+		dst, set = rgba, rgba.Set
+	}
+
+	for dy := 0; dy < dh; dy++ {
+		y0, y1 := dy*sh/dh, (dy+1)*sh/dh
+		if y1 == y0 {
+			y1++
+		}
+		for dx := 0; dx < dw; dx++ {
+			x0, x1 := dx*sw/dw, (dx+1)*sw/dw
+			if x1 == x0 {
+				x1++
+			}
+			var r, g, bl, a, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					cr, cg, cb, ca := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			set(dx, dy, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(bl / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
+
+// Histogram counts the pixels of img at each of 256 intensity levels. For
+// gray images each pixel is counted once and channels is 1; for color images
+// the red, green and blue samples are each counted, so the counts add up to
+// three times the number of pixels, and channels is 3. 16-bit samples are
+// binned down to 8 bits.
+func Histogram(img image.Image) (hist [256]uint64, channels int) {
+	b := img.Bounds()
+	gray := isGray(img)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			hist[r>>8]++
+			if !gray {
+				hist[g>>8]++
+				hist[bl>>8]++
+			}
+		}
+	}
+	if gray {
+		return hist, 1
+	}
+	return hist, 3
+}
+
+// AutoLevels returns an 8-bit copy of img with its intensities stretched to
+// the full 0-255 range, after ignoring the darkest and brightest clipPct
+// percent of samples. For color images the same mapping is applied to all
+// three channels so that colors are not shifted. Gray inputs produce an
+// *image.Gray and all others an *image.RGBA.
+func AutoLevels(img image.Image, clipPct float64) image.Image {
+	hist, _ := Histogram(img)
+	var total uint64
+	for _, n := range hist {
+		total += n
+	}
+	clip := uint64(float64(total) * clipPct / 100)
+
+	lo, hi := 0, 255
+	for sum := uint64(0); lo < 255; lo++ {
+		if sum += hist[lo]; sum > clip {
+			break
+		}
+	}
+	for sum := uint64(0); hi > 0; hi-- {
+		if sum += hist[hi]; sum > clip {
+			break
+		}
+	}
+	lo16, hi16 := float64(lo)*0x101, float64(hi)*0x101
+	if hi16 <= lo16 {
+		lo16, hi16 = 0, 0xffff
+	}
+	stretch := func(v uint32) uint8 {
+		s := (float64(v) - lo16) * 255 / (hi16 - lo16)
+		if s < 0 {
+			return 0
+		}
+		if s > 255 {
+			return 255
+		}
+		return uint8(s + 0.5)
+	}
+
+	b := img.Bounds()
+	rect := image.Rect(0, 0, b.Dx(), b.Dy())
+	if isGray(img) {
+		dst := image.NewGray(rect)
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				v, _, _, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+				dst.Pix[y*dst.Stride+x] = stretch(v)
+			}
+		}
+		return dst
+	}
+	dst := image.NewRGBA(rect)
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			r, g, bl, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			dst.SetRGBA(x, y, color.RGBA{stretch(r), stretch(g), stretch(bl), 0xff})
+		}
+	}
+	return dst
+}
+
+// inkLevel is the 16-bit intensity below which a pixel is considered ink
+// rather than paper by IsBlankPage and AutoCrop.
+const inkLevel = 0xc000
+
+// blankInkRatio is the largest fraction of ink pixels a blank page may have,
+// allowing for dust and scanner noise.
+const blankInkRatio = 0.005
+
+// isInk reports whether c is dark enough to be considered ink.
+func isInk(c color.Color) bool {
+	return color.Gray16Model.Convert(c).(color.Gray16).Y < inkLevel
+}
+
+// IsBlankPage reports whether img looks like a blank sheet of paper, i.e.
+// fewer than 0.5% of its pixels are darker than 75% intensity. This is a
+// heuristic meant for skipping the empty backs of duplex scans.
+func IsBlankPage(img image.Image) bool {
+	b := img.Bounds()
+	ink := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if isInk(img.At(x, y)) {
+				ink++
+			}
+		}
+	}
+	return float64(ink) <= blankInkRatio*float64(b.Dx()*b.Dy())
+}
+
+// AutoCrop returns the smallest part of img containing all pixels darker
+// than 75% intensity, trimming the white paper margins. img is returned
+// unchanged if it has no such pixels or does not support SubImage.
+func AutoCrop(img image.Image) image.Image {
+	sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	})
+	if !ok {
+		return img
+	}
+	b := img.Bounds()
+	crop := image.Rectangle{}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if isInk(img.At(x, y)) {
+				crop = crop.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	if crop.Empty() {
+		return img
+	}
+	return sub.SubImage(crop)
+}
+
+// ImageHash returns a 64-bit FNV-1a hash of the content of img, computed
+// over its dimensions and its pixels normalized to 8-bit RGB, so that
+// identical pixels hash equal regardless of the image type holding them
+// (e.g. an *image.Gray and an *image.RGBA of the same gray pixels). It is
+// meant for detecting duplicate pages, not for security.
+func ImageHash(img image.Image) uint64 {
+	b := img.Bounds()
+	h := fnv.New64a()
+	var buf [8]byte
+	binary.BigEndian.PutUint32(buf[:4], uint32(b.Dx()))
+	binary.BigEndian.PutUint32(buf[4:], uint32(b.Dy()))
+	h.Write(buf[:])
+	row := make([]byte, 0, 3*b.Dx())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row = row[:0]
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			row = append(row, byte(r>>8), byte(g>>8), byte(bl>>8))
+		}
+		h.Write(row)
+	}
+	return h.Sum64()
+}
+
+// Invert returns the photometric negative of img, e.g. to turn a scanned
+// film negative into a positive. *image.Gray, *image.Gray16, *image.RGBA and
+// *image.RGBA64 inputs produce an image of the same type; all others produce
+// an *image.RGBA64. Alpha is preserved.
+func Invert(img image.Image) image.Image {
+	b := img.Bounds()
+	switch src := img.(type) {
+	case *image.Gray:
+		dst := image.NewGray(b)
+		for y := 0; y < b.Dy(); y++ {
+			s, d := src.Pix[y*src.Stride:], dst.Pix[y*dst.Stride:]
+			for x := 0; x < b.Dx(); x++ {
+				d[x] = ^s[x]
+			}
+		}
+		return dst
+
+	case *image.Gray16:
+		dst := image.NewGray16(b)
+		for y := 0; y < b.Dy(); y++ {
+			s, d := src.Pix[y*src.Stride:], dst.Pix[y*dst.Stride:]
+			for x := 0; x < 2*b.Dx(); x++ {
+				d[x] = ^s[x]
+			}
+		}
+		return dst
+
+	case *image.RGBA:
+		dst := image.NewRGBA(b)
+		for y := 0; y < b.Dy(); y++ {
+			s, d := src.Pix[y*src.Stride:], dst.Pix[y*dst.Stride:]
+			for x := 0; x < 4*b.Dx(); x += 4 {
+				a := s[x+3]
+				// Samples are premultiplied by alpha.
+				d[x], d[x+1], d[x+2], d[x+3] = a-s[x], a-s[x+1], a-s[x+2], a
+			}
+		}
+		return dst
+	}
+
+	dst := image.NewRGBA64(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			dst.SetRGBA64(x, y, color.RGBA64{uint16(a - r), uint16(a - g), uint16(a - bl), uint16(a)})
+		}
+	}
+	return dst
+}
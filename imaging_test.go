@@ -0,0 +1,212 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestInvert(t *testing.T) {
+	r := image.Rect(1, 2, 3, 4)
+	gray := image.NewGray(r)
+	gray.SetGray(1, 2, color.Gray{0x10})
+	gray16 := image.NewGray16(r)
+	gray16.SetGray16(1, 2, color.Gray16{0x1234})
+	rgba := image.NewRGBA(r)
+	rgba.SetRGBA(1, 2, color.RGBA{0x10, 0x20, 0x30, 0xff})
+	rgba.SetRGBA(2, 2, color.RGBA{0x10, 0x20, 0x30, 0x80})
+	rgba64 := image.NewRGBA64(r)
+	rgba64.SetRGBA64(1, 2, color.RGBA64{0x1000, 0x2000, 0x3000, 0xffff})
+	nrgba := image.NewNRGBA(r)
+	nrgba.SetNRGBA(1, 2, color.NRGBA{0x10, 0x20, 0x30, 0xff})
+
+	for _, c := range []struct {
+		img  image.Image
+		x, y int
+		want color.Color
+	}{
+		{gray, 1, 2, color.Gray{0xef}},
+		{gray, 2, 3, color.Gray{0xff}},
+		{gray16, 1, 2, color.Gray16{0xedcb}},
+		{rgba, 1, 2, color.RGBA{0xef, 0xdf, 0xcf, 0xff}},
+		{rgba, 2, 2, color.RGBA{0x70, 0x60, 0x50, 0x80}},
+		{rgba64, 1, 2, color.RGBA64{0xefff, 0xdfff, 0xcfff, 0xffff}},
+		{nrgba, 1, 2, color.RGBA64{0xefef, 0xdfdf, 0xcfcf, 0xffff}},
+	} {
+		inv := Invert(c.img)
+		if inv.Bounds() != r {
+			t.Errorf("%T: bounds %v, want %v", c.img, inv.Bounds(), r)
+		}
+		if got := inv.At(c.x, c.y); got != c.want {
+			t.Errorf("%T at (%d, %d): %v, want %v", c.img, c.x, c.y, got, c.want)
+		}
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		img    image.Image
+		maxDim int
+		w, h   int
+	}{
+		{"portrait", image.NewRGBA64(image.Rect(0, 0, 2550, 3508)), 200, 145, 200},
+		{"landscape", image.NewGray16(image.Rect(0, 0, 3508, 2550)), 200, 200, 145},
+		{"offset", image.NewRGBA64(image.Rect(10, 10, 410, 110)), 100, 100, 25},
+		{"small", image.NewGray16(image.Rect(0, 0, 50, 30)), 200, 50, 30},
+	} {
+		thumb := Thumbnail(c.img, c.maxDim)
+		if b := thumb.Bounds(); b != image.Rect(0, 0, c.w, c.h) {
+			t.Errorf("%s: thumbnail bounds %v, want %dx%d", c.name, b, c.w, c.h)
+		}
+		_, gray := c.img.(*image.Gray16)
+		switch thumb.(type) {
+		case *image.Gray:
+			if !gray {
+				t.Errorf("%s: color image thumbnailed as gray", c.name)
+			}
+		case *image.RGBA:
+			if gray {
+				t.Errorf("%s: gray image thumbnailed as RGBA", c.name)
+			}
+		default:
+			t.Errorf("%s: thumbnail is a %T", c.name, thumb)
+		}
+	}
+}
+
+func TestThumbnailAverages(t *testing.T) {
+	src := image.NewGray16(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		v := uint16(0)
+		if x%2 == 1 {
+			v = 0xffff
+		}
+		src.SetGray16(x, 0, color.Gray16{v})
+		src.SetGray16(x, 1, color.Gray16{v})
+	}
+	thumb := Thumbnail(src, 2).(*image.Gray)
+	for _, p := range thumb.Pix {
+		if p < 0x7f || p > 0x80 {
+			t.Errorf("box filter gave %#x, want mid gray", p)
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	// A 256x2 gradient holds each level twice.
+	g := image.NewGray(image.Rect(0, 0, 256, 2))
+	for i := range g.Pix {
+		g.Pix[i] = byte(i)
+	}
+	hist, channels := Histogram(g)
+	if channels != 1 {
+		t.Errorf("gray channels = %d, want 1", channels)
+	}
+	for v, n := range hist {
+		if n != 2 {
+			t.Fatalf("gray level %d counted %d times, want 2", v, n)
+		}
+	}
+
+	// 16-bit samples are binned down: 0x1234 and 0x12ff both count as 0x12.
+	g16 := image.NewGray16(image.Rect(0, 0, 2, 1))
+	g16.SetGray16(0, 0, color.Gray16{0x1234})
+	g16.SetGray16(1, 0, color.Gray16{0x12ff})
+	if hist, _ := Histogram(g16); hist[0x12] != 2 {
+		t.Errorf("16-bit samples binned as %v", hist[0x11:0x14])
+	}
+
+	c := image.NewRGBA(image.Rect(0, 0, 256, 1))
+	for x := 0; x < 256; x++ {
+		c.SetRGBA(x, 0, color.RGBA{uint8(x), uint8(255 - x), 0, 0xff})
+	}
+	hist, channels = Histogram(c)
+	if channels != 3 {
+		t.Errorf("color channels = %d, want 3", channels)
+	}
+	if hist[0] != 258 || hist[1] != 2 || hist[255] != 2 {
+		t.Errorf("color counts 0: %d, 1: %d, 255: %d; want 258, 2, 2", hist[0], hist[1], hist[255])
+	}
+}
+
+func TestAutoLevels(t *testing.T) {
+	// A dull gray image using only levels 100 to 149.
+	g := image.NewGray(image.Rect(0, 0, 50, 4))
+	for i := range g.Pix {
+		g.Pix[i] = byte(100 + i%50)
+	}
+	out, ok := AutoLevels(g, 0).(*image.Gray)
+	if !ok {
+		t.Fatal("AutoLevels of a gray image is not gray")
+	}
+	min, max := byte(255), byte(0)
+	for _, v := range out.Pix {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	if min != 0 || max != 255 {
+		t.Errorf("levels span %d to %d, want 0 to 255", min, max)
+	}
+
+	// Clipping ignores a few outliers.
+	g.Pix[0], g.Pix[1] = 0, 255
+	out = AutoLevels(g, 2).(*image.Gray)
+	if out.Pix[50] != 0 || out.Pix[0] != 0 || out.Pix[1] != 255 {
+		t.Errorf("clipped levels of 100, 0 and 255: %d, %d, %d", out.Pix[50], out.Pix[0], out.Pix[1])
+	}
+
+	// Color images get the same mapping on every channel.
+	c := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	c.SetRGBA(0, 0, color.RGBA{100, 120, 140, 0xff})
+	c.SetRGBA(1, 0, color.RGBA{140, 120, 100, 0xff})
+	rgba, ok := AutoLevels(c, 0).(*image.RGBA)
+	if !ok {
+		t.Fatal("AutoLevels of a color image is not RGBA")
+	}
+	if p, q := rgba.RGBAAt(0, 0), rgba.RGBAAt(1, 0); p.R != 0 || p.B != 255 || p.G != q.G || q.R != 255 || q.B != 0 {
+		t.Errorf("stretched colors %v and %v", p, q)
+	}
+}
+
+func TestImageHash(t *testing.T) {
+	g := image.NewGray(image.Rect(0, 0, 7, 5))
+	for i := range g.Pix {
+		g.Pix[i] = byte(i * 9)
+	}
+	// The same pixels in other image types, and offset.
+	rgba := image.NewRGBA(g.Bounds())
+	g16 := image.NewGray16(g.Bounds().Add(image.Pt(3, 4)))
+	rgba64 := image.NewRGBA64(g.Bounds())
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 7; x++ {
+			v := g.GrayAt(x, y).Y
+			rgba.SetRGBA(x, y, color.RGBA{v, v, v, 0xff})
+			g16.SetGray16(x+3, y+4, color.Gray16{uint16(v) * 0x101})
+			rgba64.SetRGBA64(x, y, color.RGBA64{uint16(v) * 0x101, uint16(v) * 0x101, uint16(v) * 0x101, 0xffff})
+		}
+	}
+	want := ImageHash(g)
+	for _, img := range []image.Image{rgba, g16, rgba64} {
+		if got := ImageHash(img); got != want {
+			t.Errorf("%T hashes to %#x, want %#x", img, got, want)
+		}
+	}
+
+	rgba.SetRGBA(6, 4, color.RGBA{1, 2, 3, 0xff})
+	if ImageHash(rgba) == want {
+		t.Error("different pixels hash equal")
+	}
+	// The same pixels arranged differently.
+	if ImageHash(&image.Gray{Pix: g.Pix, Stride: 5, Rect: image.Rect(0, 0, 5, 7)}) == want {
+		t.Error("images of different dimensions hash equal")
+	}
+}
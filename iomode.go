@@ -0,0 +1,121 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"context"
+	"time"
+)
+
+// pollInterval is how long readers wait before retrying a non-blocking Read
+// that returned no data.
+const pollInterval = 10 * time.Millisecond
+
+type ioMode int
+
+const (
+	// Plain blocking reads; the scan cannot be interrupted.
+	ioBlocking ioMode = iota
+
+	// Blocking reads, with a watchdog goroutine calling Cancel once the
+	// context is done, which makes the pending Read return.
+	ioBlockingWatchdog
+
+	// Non-blocking reads, checking the context between reads.
+	ioNonBlocking
+)
+
+// chooseIOMode decides how the high-level scan functions read from h, which
+// must have been started:
+//
+//	context        select fd   mode
+//	not cancelable -           ioBlocking
+//	cancelable     available   ioNonBlocking
+//	cancelable     missing     ioBlockingWatchdog
+//
+// A backend offering a select fd is assumed to support non-blocking I/O.
+func chooseIOMode(h SHandle, ctx context.Context) ioMode {
+	if ctx.Done() == nil {
+		return ioBlocking
+	}
+	if _, err := GetSelectFd(h); err != nil {
+		return ioBlockingWatchdog
+	}
+	return ioNonBlocking
+}
+
+// setupIOMode puts the started handle h in the I/O mode chosen by
+// chooseIOMode. The returned function must be called once reading is done.
+func setupIOMode(ctx context.Context, h SHandle) (stop func()) {
+	mode := chooseIOMode(h, ctx)
+	if mode == ioNonBlocking {
+		if err := SetIOMode(h, true); err == nil {
+			return func() { SetIOMode(h, false) }
+		}
+		mode = ioBlockingWatchdog
+	}
+	if mode == ioBlocking {
+		return func() {}
+	}
+
+	// stop waits for the watchdog to exit, so that it cannot cancel a later
+	// scan of h once ctx is done.
+	done, exited := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			Cancel(h)
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+// WouldBlock reports whether a Read on h, which must have been started,
+// would currently block, by polling its select fd without waiting. This lets
+// callers in non-blocking mode avoid reads that would return no data.
+// Unsupported is returned if h has no select fd.
+func WouldBlock(h SHandle) (bool, error) {
+	fd, err := GetSelectFd(h)
+	if err != nil {
+		return false, err
+	}
+	ready, err := fdReadable(fd)
+	if err != nil {
+		return false, err
+	}
+	return !ready, nil
+}
+
+// ReadTimeout is like Read, but gives up after d: the pending operation of h
+// is cancelled and ErrTimeout is returned. This protects services from a
+// wedged backend. It uses non-blocking reads when h has a select fd, and a
+// watchdog goroutine otherwise.
+func ReadTimeout(h SHandle, buf []byte, d time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	stop := setupIOMode(ctx, h)
+	defer stop()
+	for {
+		n, err := Read(h, buf)
+		if err != nil && ctx.Err() != nil {
+			Cancel(h)
+			return n, ErrTimeout
+		}
+		if err != nil || n > 0 {
+			return n, err
+		}
+		select {
+		case <-ctx.Done():
+			Cancel(h)
+			return 0, ErrTimeout
+		case <-time.After(pollInterval):
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// selectFake is a fakeBackend supporting non-blocking I/O, with fd as its
+// select fd. It records the modes SetIOMode is called with.
+type selectFake struct {
+	*fakeBackend
+	fd    int
+	modes []bool
+}
+
+func (f *selectFake) SetIOMode(h SHandle, nonBlocking bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("SetIOMode")
+	f.modes = append(f.modes, nonBlocking)
+	return nil
+}
+
+func (f *selectFake) GetSelectFd(h SHandle) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetSelectFd")
+	return f.fd, nil
+}
+
+func TestChooseIOMode(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, c := range []struct {
+		name      string
+		selectFd  bool
+		ctx       context.Context
+		want      ioMode
+		wantModes []bool
+	}{
+		{"blocking", false, context.Background(), ioBlocking, nil},
+		{"blocking with select fd", true, context.Background(), ioBlocking, nil},
+		{"watchdog", false, ctx, ioBlockingWatchdog, nil},
+		{"non-blocking", true, ctx, ioNonBlocking, []bool{true, false}},
+	} {
+		f := &selectFake{fakeBackend: newFakeBackend()}
+		var b Backend = f.fakeBackend
+		if c.selectFd {
+			b = f
+		}
+		SetBackend(b)
+		Init(0, nil)
+		h, err := Open("fake:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := chooseIOMode(h, c.ctx); got != c.want {
+			t.Errorf("%s: chooseIOMode = %d, want %d", c.name, got, c.want)
+		}
+		setupIOMode(c.ctx, h)()
+		if !reflect.DeepEqual(f.modes, c.wantModes) {
+			t.Errorf("%s: SetIOMode called with %v, want %v", c.name, f.modes, c.wantModes)
+		}
+		Exit()
+	}
+}
+
+func TestIOModeWatchdog(t *testing.T) {
+	f := newFakeBackend()
+	f.chunk = 1
+	f.block = make(chan struct{})
+	h := setupFake(t, f)
+	defer Exit()
+
+	// The backend lacks a select fd, so a watchdog cancels the blocked Read.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := ScanImageContext(ctx, h)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("interrupted scan succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("scan not interrupted by the context")
+	}
+	if countCalls(f, "Cancel") == 0 {
+		t.Error("watchdog did not cancel the scan")
+	}
+}
+
+func TestIOModeStop(t *testing.T) {
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	defer Exit()
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		setupIOMode(ctx, h)()
+		cancel()
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := countCalls(f, "Cancel"); n != 0 {
+		t.Errorf("stopped watchdogs cancelled %d times", n)
+	}
+}
+
+func TestWouldBlock(t *testing.T) {
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	if _, err := WouldBlock(h); err != Unsupported {
+		t.Errorf("WouldBlock without a select fd = %v, want Unsupported", err)
+	}
+	Exit()
+
+	if runtime.GOOS != "linux" {
+		t.Skip("polling is only implemented on linux")
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	SetBackend(&selectFake{fakeBackend: newFakeBackend(), fd: int(r.Fd())})
+	Init(0, nil)
+	defer Exit()
+	if h, err = Open("fake:0"); err != nil {
+		t.Fatal(err)
+	}
+	if block, err := WouldBlock(h); !block || err != nil {
+		t.Errorf("WouldBlock with no data = %v, %v; want true", block, err)
+	}
+	w.Write([]byte{0})
+	if block, err := WouldBlock(h); block || err != nil {
+		t.Errorf("WouldBlock with data ready = %v, %v; want false", block, err)
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	f := newFakeBackend()
+	f.chunk = 4
+	f.block = make(chan struct{})
+	h := setupFake(t, f)
+	defer Exit()
+	if err := Start(h); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 8)
+	if n, err := ReadTimeout(h, buf, time.Second); n != 4 || err != nil {
+		t.Fatalf("ReadTimeout of ready data = %d, %v", n, err)
+	}
+	// The next Read hangs until the scan is cancelled.
+	start := time.Now()
+	if _, err := ReadTimeout(h, buf, 20*time.Millisecond); err != ErrTimeout {
+		t.Errorf("ReadTimeout of a hung read = %v, want ErrTimeout", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("ReadTimeout took %v", d)
+	}
+	if countCalls(f, "Cancel") == 0 {
+		t.Error("hung read not cancelled")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+// Option names which are not part of saneopts.h but are shared by several
+// backends (e.g. genesys and plustek) to control calibration and the lamp.
+const (
+	// NameCalibrationCache is a TypeBool option enabling the reuse of
+	// calibration data between scans.
+	NameCalibrationCache SStringConst = "calibration-cache"
+
+	// NameLampOffTime is a TypeInt option giving the number of minutes of
+	// inactivity after which the lamp is turned off, 0 meaning never.
+	NameLampOffTime SStringConst = "lamp-off-time"
+
+	// NameLampOffAtExit is a TypeBool option turning the lamp off when the
+	// handle is closed.
+	NameLampOffAtExit SStringConst = "lamp-off-at-exit"
+)
+
+// SetCalibrationCache enables or disables the calibration cache of h.
+// Unsupported is returned if h has no such option.
+func SetCalibrationCache(h SHandle, enabled bool) error {
+	_, err := setBoolOption(h, NameCalibrationCache, enabled)
+	return err
+}
+
+// CalibrationCache reports whether the calibration cache of h is enabled.
+// Unsupported is returned if h has no such option.
+func CalibrationCache(h SHandle) (bool, error) {
+	return getBoolOption(h, NameCalibrationCache)
+}
+
+// SetLampOffTime sets the number of idle minutes after which the lamp of h
+// is turned off, and returns the value the backend applied. Inval is
+// returned if minutes is out of the option's range, and Unsupported if h
+// has no such option.
+func SetLampOffTime(h SHandle, minutes int) (int, error) {
+	v, err := setRangedOption(h, NameLampOffTime, float64(minutes))
+	return int(v), err
+}
+
+// GetLampOffTime returns the number of idle minutes after which the lamp of
+// h is turned off, 0 meaning never.
+func GetLampOffTime(h SHandle) (int, error) {
+	v, _, err := getFloatOption(h, NameLampOffTime)
+	return int(v), err
+}
+
+// DisableLampTimeout keeps the lamp of h on while idle, so that long batch
+// jobs don't wait for the lamp to warm up again between pages. If the
+// lamp-off-time option does not allow 0 (never), it is set to its maximum
+// instead. Unsupported is returned if h has no such option.
+func DisableLampTimeout(h SHandle) error {
+	_, d, err := FindOption(h, NameLampOffTime)
+	if err != nil {
+		return err
+	}
+	v := 0.0
+	if min, max, _, ok := d.RangeInfo(); ok && min > 0 {
+		v = max
+	}
+	_, err = setRangedOption(h, NameLampOffTime, v)
+	return err
+}
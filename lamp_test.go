@@ -0,0 +1,59 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import "testing"
+
+func TestDisableLampTimeout(t *testing.T) {
+	f := newFakeBackend()
+	f.addOption(OptionDescriptor{Name: NameLampOffTime, Type: TypeInt, Size: 4,
+		Cap: SoftSelect | SoftDetect, Constraint: RangeConstraint{SRange{Min: 0, Max: 60}}}, 15)
+	f.addOption(OptionDescriptor{Name: NameCalibrationCache, Type: TypeBool, Size: 4,
+		Cap: SoftSelect | SoftDetect}, SWord(SFALSE))
+	h := setupFake(t, f)
+	defer Exit()
+	lamp := f.option(NameLampOffTime)
+
+	if m, err := GetLampOffTime(h); m != 15 || err != nil {
+		t.Errorf("GetLampOffTime = %d, %v; want 15", m, err)
+	}
+	if err := DisableLampTimeout(h); err != nil {
+		t.Fatal(err)
+	}
+	if lamp.words[0] != 0 {
+		t.Errorf("lamp-off-time = %d after DisableLampTimeout, want 0", lamp.words[0])
+	}
+	if m, err := SetLampOffTime(h, 30); m != 30 || err != nil || lamp.words[0] != 30 {
+		t.Errorf("SetLampOffTime(30) = %d, %v", m, err)
+	}
+	if _, err := SetLampOffTime(h, 90); err != Inval {
+		t.Errorf("SetLampOffTime out of range = %v, want Inval", err)
+	}
+
+	// Without a "never" value, the longest timeout is used.
+	lamp.desc.Constraint = RangeConstraint{SRange{Min: 1, Max: 60}}
+	if err := DisableLampTimeout(h); err != nil || lamp.words[0] != 60 {
+		t.Errorf("DisableLampTimeout = %v, lamp-off-time %d; want 60", err, lamp.words[0])
+	}
+
+	if err := SetCalibrationCache(h, true); err != nil {
+		t.Fatal(err)
+	}
+	if on, err := CalibrationCache(h); !on || err != nil {
+		t.Errorf("CalibrationCache = %v, %v; want true", on, err)
+	}
+}
+
+func TestDisableLampTimeoutUnsupported(t *testing.T) {
+	h := setupFake(t, newFakeBackend())
+	defer Exit()
+
+	if err := DisableLampTimeout(h); err != Unsupported {
+		t.Errorf("DisableLampTimeout = %v, want Unsupported", err)
+	}
+	if err := SetCalibrationCache(h, true); err != Unsupported {
+		t.Errorf("SetCalibrationCache = %v, want Unsupported", err)
+	}
+}
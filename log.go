@@ -0,0 +1,42 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"sync"
+)
+
+// Logger is used to report problems that are not returned as errors, such
+// as a Scanner being garbage collected without being closed.
+// *log.Logger satisfies this interface.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+type discardLogger struct{}
+
+func (discardLogger) Printf(format string, v ...interface{}) {}
+
+var (
+	loggerMu sync.RWMutex
+	logger   Logger = discardLogger{}
+)
+
+// SetLogger sets the Logger used by gosane. Passing nil discards all output,
+// which is the default.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = discardLogger{}
+	}
+	loggerMu.Lock()
+	logger = l
+	loggerMu.Unlock()
+}
+
+func currentLogger() Logger {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return logger
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// MetricsSink receives measurements of the scans made through gosane, e.g.
+// to export them to Prometheus. Its methods are called synchronously from
+// the operations, possibly from several goroutines at once, so they should
+// be fast and safe for concurrent use.
+type MetricsSink interface {
+	// ObserveScanDuration is called when a scan ends with Cancel, with the
+	// time elapsed since it was started with Start. A scan of several
+	// frames is observed once.
+	ObserveScanDuration(d time.Duration)
+
+	// ObserveBytesRead is called for each Read returning n > 0 bytes.
+	ObserveBytesRead(n int)
+
+	// IncScanError is called when Start or Read fails with status. Eof,
+	// which ends every frame, is not an error.
+	IncScanError(status SStatus)
+}
+
+type discardMetrics struct{}
+
+func (discardMetrics) ObserveScanDuration(d time.Duration) {}
+func (discardMetrics) ObserveBytesRead(n int)              {}
+func (discardMetrics) IncScanError(status SStatus)         {}
+
+var (
+	metricsMu sync.RWMutex
+	metrics   MetricsSink = discardMetrics{}
+)
+
+// SetMetricsSink sets the MetricsSink gosane reports to. Passing nil
+// discards all measurements, which is the default.
+func SetMetricsSink(m MetricsSink) {
+	if m == nil {
+		m = discardMetrics{}
+	}
+	metricsMu.Lock()
+	metrics = m
+	metricsMu.Unlock()
+}
+
+func currentMetrics() MetricsSink {
+	metricsMu.RLock()
+	defer metricsMu.RUnlock()
+	return metrics
+}
+
+// observeError reports err, returned by a scan operation, to the sink.
+func observeError(err error) {
+	var status SStatus
+	if errors.As(err, &status) && status != Eof {
+		currentMetrics().IncScanError(status)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordMetrics is a MetricsSink keeping what it observes.
+type recordMetrics struct {
+	mu        sync.Mutex
+	durations []time.Duration
+	bytes     int
+	reads     int
+	errors    []SStatus
+}
+
+func (m *recordMetrics) ObserveScanDuration(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.durations = append(m.durations, d)
+}
+
+func (m *recordMetrics) ObserveBytesRead(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bytes += n
+	m.reads++
+}
+
+func (m *recordMetrics) IncScanError(status SStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errors = append(m.errors, status)
+}
+
+func TestMetricsSink(t *testing.T) {
+	f := newFakeBackend()
+	f.params = Parameters{Format: FrameGray, LastFrame: STRUE, BytesPerLine: 10, PixelsPerLine: 10, Lines: 10, Depth: 8}
+	f.data = make([]byte, 100)
+	f.chunk = 30
+	// The device takes a while to warm up.
+	f.onStart = func() error {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	}
+	h := setupFake(t, f)
+	defer Exit()
+	m := &recordMetrics{}
+	SetMetricsSink(m)
+	defer SetMetricsSink(nil)
+
+	if _, err := ScanImage(h); err != nil {
+		t.Fatal(err)
+	}
+	if m.bytes != 100 || m.reads != 4 {
+		t.Errorf("observed %d bytes in %d reads, want 100 in 4", m.bytes, m.reads)
+	}
+	if len(m.durations) != 1 || m.durations[0] <= 0 {
+		t.Errorf("observed scan durations %v, want one", m.durations)
+	}
+	if len(m.errors) != 0 {
+		t.Errorf("observed errors %v for a good scan", m.errors)
+	}
+
+	f.readErr = Jammed
+	ScanImage(h)
+	f.onStart = func() error { return NoDocs }
+	ScanImage(h)
+	if want := []SStatus{Jammed, NoDocs}; !reflect.DeepEqual(m.errors, want) {
+		t.Errorf("observed errors %v, want %v", m.errors, want)
+	}
+
+	// Without a sink nothing is reported.
+	bytes, scans := m.bytes, len(m.durations)
+	SetMetricsSink(nil)
+	f.onStart, f.readErr = nil, nil
+	ScanImage(h)
+	if m.bytes != bytes || len(m.durations) != scans {
+		t.Error("scan reported after removing the sink")
+	}
+}
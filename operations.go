@@ -4,6 +4,11 @@
 
 package gosane
 
+import (
+	"strings"
+	"sync"
+)
+
 const (
 	MaxUsernameLen SInt = 128
 	MaxPasswordLen SInt = 128
@@ -11,6 +16,381 @@ const (
 
 type AuthorizationCallback func(resource SStringConst, username SChar, password SChar)
 
-func Init(verionCode SInt, authorize AuthorizationCallback) error {
-	return SStatus(Good)
+var (
+	initMu    sync.Mutex
+	initCount int
+	version   SInt
+)
+
+// Init initializes the installed Backend. It must be called before any other
+// operation.
+//
+// Init and Exit are reference counted so that independent components of a
+// program can each call them: only the first Init initializes the Backend and
+// only the matching last Exit releases it.
+//
+// versionCode is the SANE version the caller targets, as built by
+// VersionCode; if it is 0, the version gosane targets is assumed. If the
+// major version of the backend differs, Init still succeeds but returns a
+// *VersionMismatch, which callers may choose to ignore.
+func Init(versionCode SInt, authorize AuthorizationCallback) error {
+	initMu.Lock()
+	defer initMu.Unlock()
+	if backend == nil {
+		return &LibError{Op: "Init", Err: ErrNoBackend}
+	}
+	if initCount == 0 {
+		v, err := backend.Init(authorize)
+		if err != nil {
+			return err
+		}
+		version = v
+	}
+	initCount++
+
+	if versionCode == 0 {
+		versionCode = VersionCode(CurrentMajor, CurrentMinor, 0)
+	}
+	if VersionMajor(version) != VersionMajor(versionCode) {
+		return &VersionMismatch{Want: versionCode, Got: version}
+	}
+	return nil
+}
+
+// Version returns the version code reported by the backend when it was
+// initialized, or 0 if Init has not been called.
+func Version() SInt {
+	initMu.Lock()
+	defer initMu.Unlock()
+	if initCount == 0 {
+		return 0
+	}
+	return version
+}
+
+// checkInit returns a LibError for op if Init has not been called.
+func checkInit(op string) error {
+	initMu.Lock()
+	defer initMu.Unlock()
+	if initCount == 0 {
+		return &LibError{Op: op, Err: ErrNotInitialized}
+	}
+	return nil
+}
+
+// Exit releases the installed Backend once it has been called as many times
+// as Init. Calling Exit without a matching Init is a no-op.
+//
+// Handles still open at that point are cancelled and closed, in the order
+// they were opened, before the Backend is released, so that a program may
+// safely exit in the middle of a scan.
+func Exit() {
+	initMu.Lock()
+	defer initMu.Unlock()
+	if initCount == 0 {
+		return
+	}
+	initCount--
+	if initCount == 0 && backend != nil {
+		for _, h := range openHandles() {
+			backend.Cancel(h)
+			unregisterHandle(h)
+			backend.Close(h)
+		}
+		flushDeviceCache()
+		backend.Exit()
+	}
+}
+
+// GetDevices returns the list of available devices. If localOnly is true,
+// only devices directly attached to the local machine are returned, which
+// excludes devices reachable through the network.
+//
+// If a cache TTL was set with SetDeviceCacheTTL, the result of a previous
+// call made within the TTL is returned instead of probing the backend.
+func GetDevices(localOnly bool) ([]Device, error) {
+	if err := checkInit("GetDevices"); err != nil {
+		return nil, err
+	}
+	if devs, ok := cachedDevices(localOnly); ok {
+		return translateDevices(devs), nil
+	}
+	return getDevices(localOnly)
+}
+
+// GetDevicesForceRefresh is like GetDevices, but always probes the backend,
+// refreshing the cache.
+func GetDevicesForceRefresh(localOnly bool) ([]Device, error) {
+	if err := checkInit("GetDevicesForceRefresh"); err != nil {
+		return nil, err
+	}
+	return getDevices(localOnly)
+}
+
+func getDevices(localOnly bool) ([]Device, error) {
+	devs, err := backend.GetDevices(localOnly)
+	if err != nil {
+		return nil, err
+	}
+	cacheDevices(localOnly, devs)
+	return translateDevices(devs), nil
+}
+
+// Open establishes a connection to the device named name. The name should
+// be one of the names returned by GetDevices, or an empty string to open the
+// first available device.
+func Open(name SStringConst) (SHandle, error) {
+	if err := checkInit("Open"); err != nil {
+		return nil, err
+	}
+	h, err := backend.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	registerHandle(h)
+	return h, nil
+}
+
+// Close terminates the association between h and the device it represents.
+// If the device is presently active, a call to Cancel is performed first.
+func Close(h SHandle) {
+	if checkInit("Close") != nil {
+		return
+	}
+	unregisterHandle(h)
+	backend.Close(h)
+}
+
+// GetOptionDescriptor returns the descriptor of option n of h, or nil if
+// there is no such option. Option 0 is always the number of options
+// available for h.
+func GetOptionDescriptor(h SHandle, n SInt) *OptionDescriptor {
+	if checkInit("GetOptionDescriptor") != nil {
+		return nil
+	}
+	return translateDescriptor(backend.GetOptionDescriptor(h, n))
+}
+
+// GetOptionDescriptors returns the descriptors of all options of h, indexed
+// by option number, so element 0 describes the option holding the number of
+// options. Entries may be nil. Backends implementing DescriptorLister return
+// them at once; for others GetOptionDescriptor is called for each option.
+func GetOptionDescriptors(h SHandle) ([]*OptionDescriptor, error) {
+	if err := checkInit("GetOptionDescriptors"); err != nil {
+		return nil, err
+	}
+	if l, ok := backend.(DescriptorLister); ok {
+		ds, err := l.GetOptionDescriptors(h)
+		if err != nil {
+			return nil, err
+		}
+		t := make([]*OptionDescriptor, len(ds))
+		for n, d := range ds {
+			t[n] = translateDescriptor(d)
+		}
+		return t, nil
+	}
+	count, err := optionCount(h)
+	if err != nil {
+		return nil, err
+	}
+	if count < 1 {
+		count = 1
+	}
+	ds := make([]*OptionDescriptor, count)
+	for n := range ds {
+		ds[n] = GetOptionDescriptor(h, SInt(n))
+	}
+	return ds, nil
+}
+
+// ControlOption gets or sets the value of option n of h, depending on a.
+//
+// v must hold a buffer matching the option's type:
+//
+//	TypeBool, TypeInt, TypeFixed: a []SWord of length Size / 4
+//	TypeFixed: alternatively a []float64 of length Size / 4
+//	TypeString: an SString of length Size
+//	TypeButton, TypeGroup: nil
+//
+// With ActionGetValue the buffer is filled with the current value; with
+// ActionSetValue it holds the new value and is updated in place if the
+// backend had to round it (in which case InfoInexact is set). v is ignored
+// for ActionSetAuto.
+//
+// While h is acquiring (see IsStarted), only options with the
+// AlwaysSettable capability may be set, e.g. to adjust the gain of a video
+// camera; setting others fails with a LibError wrapping ErrScanInProgress.
+func ControlOption(h SHandle, n SInt, a Action, v interface{}) (Info, error) {
+	if err := checkInit("ControlOption"); err != nil {
+		return 0, err
+	}
+	if a != ActionGetValue && acquiring(h) {
+		if d := backend.GetOptionDescriptor(h, n); d == nil || d.Cap&AlwaysSettable == 0 {
+			return 0, &LibError{Op: "ControlOption", Err: ErrScanInProgress}
+		}
+	}
+	if fs, ok := v.([]float64); ok {
+		return controlFixedVector(h, n, a, fs)
+	}
+	return backend.ControlOption(h, n, a, v)
+}
+
+// controlFixedVector implements ControlOption for a []float64 buffer by
+// converting it from and to fixed-point words.
+func controlFixedVector(h SHandle, n SInt, a Action, fs []float64) (Info, error) {
+	d := backend.GetOptionDescriptor(h, n)
+	if d == nil {
+		return 0, Inval
+	}
+	if d.Type != TypeFixed {
+		return 0, typeMismatch(d.Name)
+	}
+	words := make([]SWord, len(fs))
+	for i, f := range fs {
+		words[i] = SWord(FloatToFixed(f))
+	}
+	info, err := backend.ControlOption(h, n, a, words)
+	if err != nil {
+		return info, err
+	}
+	for i, w := range words {
+		fs[i] = FixedToFloat(SFixed(w))
+	}
+	return info, nil
+}
+
+// getOptionValues reads option ns[i] of h into bufs[i], a buffer as passed
+// to ControlOption with ActionGetValue. Backends implementing ValueGetter
+// are asked for all the values at once, subject to the same checks as
+// ControlOption; for others ControlOption is called for each option.
+func getOptionValues(h SHandle, ns []SInt, bufs []interface{}) error {
+	if err := checkInit("ControlOption"); err != nil {
+		return err
+	}
+	g, ok := backend.(ValueGetter)
+	if !ok {
+		for i, n := range ns {
+			if _, err := ControlOption(h, n, ActionGetValue, bufs[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return g.GetOptionValues(h, ns, bufs)
+}
+
+// GetParameters returns the scan parameters of h. Before Start is called the
+// parameters are a best-effort guess of what they will be once acquisition
+// starts; between Start and the completion of the frame they are exact.
+// IsStarted tells which is the case.
+func GetParameters(h SHandle) (*Parameters, error) {
+	if err := checkInit("GetParameters"); err != nil {
+		return nil, err
+	}
+	return backend.GetParameters(h)
+}
+
+// Start initiates acquisition of a frame from h.
+func Start(h SHandle) error {
+	if err := checkInit("Start"); err != nil {
+		return err
+	}
+	if err := backend.Start(h); err != nil {
+		observeError(err)
+		return err
+	}
+	setStarted(h, true)
+	return nil
+}
+
+// Read reads up to len(buf) bytes of image data of the current frame from h.
+// Read may return fewer bytes than requested; Eof is returned once the frame
+// has been read entirely. A LibError wrapping ErrNotStarted is returned if
+// h has not been started with Start.
+func Read(h SHandle, buf []byte) (int, error) {
+	if err := checkInit("Read"); err != nil {
+		return 0, err
+	}
+	if notStarted(h) {
+		return 0, &LibError{Op: "Read", Err: ErrNotStarted}
+	}
+	n, err := backend.Read(h, buf)
+	if n > 0 {
+		currentMetrics().ObserveBytesRead(n)
+	}
+	if err != nil {
+		observeError(err)
+	}
+	return n, err
+}
+
+// Cancel cancels the currently pending operation of h. It is also used to
+// end acquisition once all frames of an image have been read.
+func Cancel(h SHandle) {
+	if checkInit("Cancel") != nil {
+		return
+	}
+	backend.Cancel(h)
+	if d, ok := setStarted(h, false); ok {
+		currentMetrics().ObserveScanDuration(d)
+	}
+}
+
+// SetIOMode selects whether Read on h blocks (the default) or returns
+// immediately with 0 bytes when no data is available. It may only be called
+// after Start. Unsupported is returned if the backend cannot do non-blocking
+// I/O.
+func SetIOMode(h SHandle, nonBlocking bool) error {
+	if err := checkInit("SetIOMode"); err != nil {
+		return err
+	}
+	return backend.SetIOMode(h, nonBlocking)
+}
+
+// GetSelectFd returns a file descriptor that becomes readable when image
+// data is available from h, for use with select or poll. It may only be
+// called after Start. Unsupported is returned if no such descriptor exists.
+func GetSelectFd(h SHandle) (int, error) {
+	if err := checkInit("GetSelectFd"); err != nil {
+		return -1, err
+	}
+	return backend.GetSelectFd(h)
+}
+
+// ParseAuthResource splits the resource string passed to an
+// AuthorizationCallback into its parts, so that a meaningful prompt can be
+// shown (e.g. "password for test on host scanbox"). The recognized forms
+// are:
+//
+//	backend[:device]               a local backend
+//	net:host:backend[:device]      a backend on a remote saned, where host may
+//	                               be an IPv6 address in brackets
+//	<either of the above>$realm    with a realm or domain
+//
+// A "$MD5$salt" suffix requests MD5 hashed passwords and is not a realm.
+func ParseAuthResource(r SStringConst) (backend, host, realm string) {
+	s := string(r)
+	if i := strings.IndexByte(s, '$'); i >= 0 {
+		s, realm = s[:i], s[i+1:]
+		if strings.HasPrefix(realm, "MD5$") {
+			realm = ""
+		}
+	}
+	if strings.HasPrefix(s, "net:") {
+		s = s[len("net:"):]
+		if strings.HasPrefix(s, "[") {
+			if i := strings.IndexByte(s, ']'); i >= 0 {
+				host, s = s[1:i], strings.TrimPrefix(s[i+1:], ":")
+			}
+		} else if i := strings.IndexByte(s, ':'); i >= 0 {
+			host, s = s[:i], s[i+1:]
+		} else {
+			host, s = s, ""
+		}
+	}
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		s = s[:i]
+	}
+	return s, host, realm
 }
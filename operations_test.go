@@ -0,0 +1,372 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countCalls returns how many times f recorded op.
+func countCalls(f *fakeBackend, op string) int {
+	n := 0
+	for _, c := range f.called() {
+		if c == op {
+			n++
+		}
+	}
+	return n
+}
+
+func TestInitRefcount(t *testing.T) {
+	f := newFakeBackend()
+	SetBackend(f)
+
+	if err := Init(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := Init(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	Exit()
+	if _, err := Open("fake:0"); err != nil {
+		t.Fatalf("Open after nested Exit: %v", err)
+	}
+	if n := countCalls(f, "Exit"); n != 0 {
+		t.Fatalf("backend exited %d times while still in use", n)
+	}
+	Exit()
+	Exit() // unmatched, a no-op
+
+	if i, e := countCalls(f, "Init"), countCalls(f, "Exit"); i != 1 || e != 1 {
+		t.Errorf("backend initialized %d times and exited %d times, want 1 and 1", i, e)
+	}
+	var le *LibError
+	if _, err := Open("fake:0"); !errors.As(err, &le) || le.Err != ErrNotInitialized {
+		t.Errorf("Open after Exit: %v, want ErrNotInitialized", err)
+	}
+}
+
+func TestExitClosesHandles(t *testing.T) {
+	f := newFakeBackend()
+	SetBackend(f)
+	Init(0, nil)
+	a, _ := Open("fake:0")
+	b, _ := Open("fake:0")
+	Exit()
+	if f.isOpen(a) || f.isOpen(b) {
+		t.Error("Exit left handles open")
+	}
+	calls := f.called()
+	want := []string{"Cancel", "Close", "Cancel", "Close", "Exit"}
+	if got := calls[len(calls)-len(want):]; !reflect.DeepEqual(got, want) {
+		t.Errorf("Exit called %v, want %v", got, want)
+	}
+}
+
+func TestExitWhileScanning(t *testing.T) {
+	f := newFakeBackend()
+	f.chunk = 1
+	f.block = make(chan struct{})
+	h := setupFake(t, f)
+	idle, _ := Open("fake:0")
+	if err := Start(h); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(h, make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	// A second Read is now blocked until the scan is cancelled.
+	read := make(chan error, 1)
+	go func() {
+		_, err := Read(h, make([]byte, 1))
+		read <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	Exit()
+	select {
+	case err := <-read:
+		if err != Cancelled {
+			t.Errorf("pending Read = %v, want Cancelled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Exit did not interrupt the scan")
+	}
+	if f.isOpen(h) || f.isOpen(idle) {
+		t.Error("Exit left handles open")
+	}
+	calls := f.called()
+	if calls[len(calls)-1] != "Exit" {
+		t.Errorf("backend exited before the handles were closed: %v", calls)
+	}
+}
+
+// listerFake is a fakeBackend implementing DescriptorLister.
+type listerFake struct {
+	*fakeBackend
+}
+
+func (f listerFake) GetOptionDescriptors(h SHandle) ([]*OptionDescriptor, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetOptionDescriptors")
+	ds := make([]*OptionDescriptor, len(f.opts))
+	for n, o := range f.opts {
+		d := o.desc
+		ds[n] = &d
+	}
+	return ds, nil
+}
+
+func TestGetOptionDescriptorsLister(t *testing.T) {
+	f := listerFake{newFakeBackend()}
+	f.option(NameScanMode).desc.Title = "Scan mode"
+	SetBackend(f)
+	if err := Init(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer Exit()
+	h, err := Open("fake:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetTranslator(func(key, text string) string {
+		if key == string(NameScanMode) && text == "Scan mode" {
+			return "Scanmodus"
+		}
+		return text
+	})
+	defer SetTranslator(nil)
+
+	ds, err := GetOptionDescriptors(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != len(f.opts) {
+		t.Fatalf("got %d descriptors, want %d", len(ds), len(f.opts))
+	}
+	if countCalls(f.fakeBackend, "GetOptionDescriptors") != 1 || countCalls(f.fakeBackend, "GetOptionDescriptor") != 0 {
+		t.Errorf("descriptors not listed at once: %v", f.called())
+	}
+	n, _, err := FindOption(h, NameScanMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds[n].Title != "Scanmodus" {
+		t.Errorf("listed title %q was not translated", ds[n].Title)
+	}
+}
+
+func TestControlOptionWhileAcquiring(t *testing.T) {
+	f := newFakeBackend()
+	gain := f.addOption(OptionDescriptor{Name: "gain", Type: TypeInt, Size: 4,
+		Cap: SoftSelect | SoftDetect | AlwaysSettable}, 1)
+	h := setupFake(t, f)
+	defer Exit()
+
+	if err := Start(h); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ControlOption(h, gain, ActionSetValue, []SWord{5}); err != nil {
+		t.Errorf("setting an AlwaysSettable option while acquiring: %v", err)
+	}
+	if g := f.option("gain").words[0]; g != 5 {
+		t.Errorf("gain = %d, want 5", g)
+	}
+	res, _, _ := FindOption(h, NameScanResolution)
+	if _, err := ControlOption(h, res, ActionSetValue, []SWord{150}); !errors.Is(err, ErrScanInProgress) {
+		t.Errorf("setting resolution while acquiring = %v, want ErrScanInProgress", err)
+	}
+	v := []SWord{0}
+	if _, err := ControlOption(h, res, ActionGetValue, v); err != nil || v[0] != 300 {
+		t.Errorf("reading resolution while acquiring = %d, %v", v[0], err)
+	}
+
+	Cancel(h)
+	if _, err := ControlOption(h, res, ActionSetValue, []SWord{150}); err != nil {
+		t.Errorf("setting resolution after Cancel: %v", err)
+	}
+}
+
+func TestParseAuthResource(t *testing.T) {
+	for _, c := range []struct {
+		r                    SStringConst
+		backend, host, realm string
+	}{
+		{"test", "test", "", ""},
+		{"epson2:libusb:001:005", "epson2", "", ""},
+		{"net:scanbox:epson2:libusb:001:005", "epson2", "scanbox", ""},
+		{"net:scanbox", "", "scanbox", ""},
+		{"net:[fe80::1]:plustek:libusb:002:003", "plustek", "fe80::1", ""},
+		{"net:10.0.0.2:fujitsu$office", "fujitsu", "10.0.0.2", "office"},
+		{"test$MD5$0123abcd", "test", "", ""},
+		{"", "", "", ""},
+	} {
+		backend, host, realm := ParseAuthResource(c.r)
+		if backend != c.backend || host != c.host || realm != c.realm {
+			t.Errorf("ParseAuthResource(%q) = %q, %q, %q; want %q, %q, %q",
+				c.r, backend, host, realm, c.backend, c.host, c.realm)
+		}
+	}
+}
+
+// oldFake is a fakeBackend implementing SANE 0.
+type oldFake struct {
+	*fakeBackend
+}
+
+func (f oldFake) Init(authorize AuthorizationCallback) (SInt, error) {
+	f.fakeBackend.Init(authorize)
+	return VersionCode(0, 42, 3), nil
+}
+
+func TestInitVersionMismatch(t *testing.T) {
+	SetBackend(oldFake{newFakeBackend()})
+	err := Init(0, nil)
+	defer Exit()
+	var vm *VersionMismatch
+	if !errors.As(err, &vm) {
+		t.Fatalf("Init = %v, want a *VersionMismatch", err)
+	}
+	if vm.Got != VersionCode(0, 42, 3) || VersionMajor(vm.Want) != CurrentMajor {
+		t.Errorf("mismatch %+v", vm)
+	}
+	if v := Version(); v != VersionCode(0, 42, 3) {
+		t.Errorf("Version = %d.%d.%d, want 0.42.3", VersionMajor(v), VersionMinor(v), VersionBuild(v))
+	}
+	// The mismatch is only a warning: the backend is usable.
+	if _, err := Open("fake:0"); err != nil {
+		t.Errorf("Open after a version mismatch: %v", err)
+	}
+	// Callers targeting the backend's version get no warning.
+	if err := Init(VersionCode(0, 1, 0), nil); err != nil {
+		t.Errorf("Init targeting SANE 0 = %v", err)
+	}
+	Exit()
+}
+
+func TestReadBeforeStart(t *testing.T) {
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	defer Exit()
+
+	if IsStarted(h) {
+		t.Error("handle started after Open")
+	}
+	if _, err := Read(h, make([]byte, 8)); !errors.Is(err, ErrNotStarted) {
+		t.Errorf("Read before Start = %v, want ErrNotStarted", err)
+	}
+	if countCalls(f, "Read") != 0 {
+		t.Error("premature Read passed to the backend")
+	}
+	// GetParameters gives an estimate before Start.
+	if p, err := GetParameters(h); err != nil || p.PixelsPerLine != 4 {
+		t.Errorf("GetParameters before Start = %v, %v", p, err)
+	}
+
+	if err := Start(h); err != nil {
+		t.Fatal(err)
+	}
+	if !IsStarted(h) {
+		t.Error("handle not started after Start")
+	}
+	if n, err := Read(h, make([]byte, 8)); n != 8 || err != nil {
+		t.Errorf("Read after Start = %d, %v", n, err)
+	}
+	Cancel(h)
+	if _, err := Read(h, make([]byte, 8)); !errors.Is(err, ErrNotStarted) {
+		t.Errorf("Read after Cancel = %v, want ErrNotStarted", err)
+	}
+
+	// Start failing leaves the handle not started.
+	f.onStart = func() error { return NoDocs }
+	if err := Start(h); err != NoDocs {
+		t.Fatalf("Start = %v, want NoDocs", err)
+	}
+	if _, err := Read(h, make([]byte, 8)); !errors.Is(err, ErrNotStarted) {
+		t.Errorf("Read after a failed Start = %v, want ErrNotStarted", err)
+	}
+}
+
+// multiFake is a fakeBackend scanning independently on each handle, as a
+// backend driving several devices does.
+type multiFake struct {
+	*fakeBackend
+	pos map[SHandle]int
+}
+
+func (f multiFake) Start(h SHandle) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Start")
+	f.pos[h] = 0
+	return nil
+}
+
+func (f multiFake) Read(h SHandle, buf []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Read")
+	pos := f.pos[h]
+	if pos >= len(f.data) {
+		return 0, Eof
+	}
+	n := len(buf)
+	if n > f.chunk {
+		n = f.chunk
+	}
+	n = copy(buf[:n], f.data[pos:])
+	f.pos[h] = pos + n
+	return n, nil
+}
+
+func TestConcurrentScans(t *testing.T) {
+	f := multiFake{newFakeBackend(), make(map[SHandle]int)}
+	f.params = Parameters{Format: FrameGray, LastFrame: STRUE, BytesPerLine: 16, PixelsPerLine: 16, Lines: 16, Depth: 8}
+	f.data = make([]byte, 16*16)
+	for i := range f.data {
+		f.data[i] = byte(i)
+	}
+	f.chunk = 7
+	SetBackend(f)
+	if err := Init(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer Exit()
+	SetLogger(&recordLogger{})
+	defer SetLogger(nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s, err := OpenScanner("fake:0")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer s.Close()
+			for j := 0; j < 10; j++ {
+				img, err := ScanImage(s.Handle())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if g, ok := img.(*image.Gray); !ok || !bytes.Equal(g.Pix, f.data) {
+					t.Error("concurrent scan returned a corrupted image")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,677 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Well-known option names, as defined by saneopts.h.
+const (
+	NameNumOptions     SStringConst = ""
+	NamePreview        SStringConst = "preview"
+	NameScanMode       SStringConst = "mode"
+	NameScanSource     SStringConst = "source"
+	NameBitDepth       SStringConst = "depth"
+	NameBitDepthAlt    SStringConst = "bit-depth"
+	NameScanResolution SStringConst = "resolution"
+	NameScanXRes       SStringConst = "x-resolution"
+	NameScanYRes       SStringConst = "y-resolution"
+	NameResolutionBind SStringConst = "resolution-bind"
+	NameScanTLX        SStringConst = "tl-x"
+	NameScanTLY        SStringConst = "tl-y"
+	NameScanBRX        SStringConst = "br-x"
+	NameScanBRY        SStringConst = "br-y"
+	NameThreshold      SStringConst = "threshold"
+	NamePageWidth      SStringConst = "page-width"
+	NamePageHeight     SStringConst = "page-height"
+	NameCalibrate      SStringConst = "calibrate"
+	NameCompression    SStringConst = "compression"
+	NameNegative       SStringConst = "negative"
+	NameBrightness     SStringConst = "brightness"
+	NameContrast       SStringConst = "contrast"
+)
+
+// Well-known values of the NameScanSource option. Backends vary widely in
+// how they name their sources; these are the most common spellings.
+const (
+	ValueScanSourceFlatbed SStringConst = "Flatbed"
+	ValueScanSourceADF     SStringConst = "ADF"
+	ValueScanSourceDuplex  SStringConst = "ADF Duplex"
+)
+
+// Well-known values of the NameScanMode option.
+const (
+	ValueScanModeColor   SStringConst = "Color"
+	ValueScanModeGray    SStringConst = "Gray"
+	ValueScanModeLineart SStringConst = "Lineart"
+)
+
+// optionCount returns the number of options of h, as reported by option 0.
+func optionCount(h SHandle) (SInt, error) {
+	v := []SWord{0}
+	if _, err := ControlOption(h, 0, ActionGetValue, v); err != nil {
+		return 0, err
+	}
+	return v[0], nil
+}
+
+// FindOption returns the number and descriptor of the option of h named
+// name. Unsupported is returned if h has no such option.
+func FindOption(h SHandle, name SStringConst) (SInt, *OptionDescriptor, error) {
+	ds, err := GetOptionDescriptors(h)
+	if err != nil {
+		return 0, nil, err
+	}
+	for n := 1; n < len(ds); n++ {
+		if d := ds[n]; d != nil && d.Name == name {
+			return SInt(n), d, nil
+		}
+	}
+	return 0, nil, Unsupported
+}
+
+// HasOption reports whether h has an option named name, active or not, for
+// feature detection (e.g. to only show a duplex toggle for devices with a
+// source option). An error is only returned if the options of h cannot be
+// read.
+func HasOption(h SHandle, name SStringConst) (bool, error) {
+	_, _, err := FindOption(h, name)
+	if err == Unsupported {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// wordToFloat interprets w according to t, converting from fixed-point when
+// t is TypeFixed.
+func wordToFloat(t ValueType, w SWord) float64 {
+	if t == TypeFixed {
+		return FixedToFloat(SFixed(w))
+	}
+	return float64(w)
+}
+
+// RangeInfo returns the range constraint of d as floats, converting from
+// fixed-point when d.Type is TypeFixed. ok is false if d is not constrained
+// by a range.
+func (d *OptionDescriptor) RangeInfo() (min, max, quant float64, ok bool) {
+	r := d.Range()
+	if r == nil {
+		return 0, 0, 0, false
+	}
+	return wordToFloat(d.Type, r.Min), wordToFloat(d.Type, r.Max), wordToFloat(d.Type, r.Quant), true
+}
+
+// FindOptionByTitle returns the number and descriptor of the option of h
+// whose Title is title, ignoring case, for frontends that only know the
+// human readable title. Unsupported is returned if no option has the title,
+// and a LibError wrapping ErrAmbiguousTitle if several do.
+func FindOptionByTitle(h SHandle, title string) (SInt, *OptionDescriptor, error) {
+	ds, err := GetOptionDescriptors(h)
+	if err != nil {
+		return 0, nil, err
+	}
+	var found SInt
+	var desc *OptionDescriptor
+	for n := 1; n < len(ds); n++ {
+		d := ds[n]
+		if d == nil || d.Type == TypeGroup || !strings.EqualFold(string(d.Title), title) {
+			continue
+		}
+		if desc != nil {
+			return 0, nil, &LibError{Op: "FindOptionByTitle " + title, Err: ErrAmbiguousTitle}
+		}
+		found, desc = SInt(n), d
+	}
+	if desc == nil {
+		return 0, nil, Unsupported
+	}
+	return found, desc, nil
+}
+
+// floatToWord converts v to an SWord according to t, converting to
+// fixed-point when t is TypeFixed and rounding otherwise.
+func floatToWord(t ValueType, v float64) SWord {
+	if t == TypeFixed {
+		return SWord(FloatToFixed(v))
+	}
+	return SWord(math.Round(v))
+}
+
+// getFloatOption returns the value of the numeric option named name.
+func getFloatOption(h SHandle, name SStringConst) (float64, *OptionDescriptor, error) {
+	n, d, err := FindOption(h, name)
+	if err != nil {
+		return 0, nil, err
+	}
+	if d.Type != TypeInt && d.Type != TypeFixed {
+		return 0, d, typeMismatch(name)
+	}
+	v := []SWord{0}
+	if _, err := ControlOption(h, n, ActionGetValue, v); err != nil {
+		return 0, d, err
+	}
+	return wordToFloat(d.Type, v[0]), d, nil
+}
+
+// setFloatOption sets the numeric option named name to v, and returns the
+// value actually applied by the backend.
+func setFloatOption(h SHandle, name SStringConst, v float64) (float64, Info, error) {
+	n, d, err := FindOption(h, name)
+	if err != nil {
+		return 0, 0, err
+	}
+	if d.Type != TypeInt && d.Type != TypeFixed {
+		return 0, 0, typeMismatch(name)
+	}
+	w := []SWord{floatToWord(d.Type, v)}
+	info, err := ControlOption(h, n, ActionSetValue, w)
+	if err != nil {
+		return 0, info, err
+	}
+	return wordToFloat(d.Type, w[0]), info, nil
+}
+
+// SetThreshold sets the lineart threshold of h to percent, which is mapped
+// onto the range of the threshold option. The option is usually only active
+// when the scan mode is ValueScanModeLineart; a LibError wrapping
+// ErrOptionInactive is returned otherwise.
+func SetThreshold(h SHandle, percent float64) error {
+	if percent < 0 || percent > 100 {
+		return Inval
+	}
+	_, d, err := FindOption(h, NameThreshold)
+	if err != nil {
+		return err
+	}
+	if d.Cap&Inactive != 0 {
+		return &LibError{Op: "SetThreshold", Err: ErrOptionInactive}
+	}
+	v, ok := percentOfRange(d, percent)
+	if !ok {
+		v = percent
+	}
+	_, _, err = setFloatOption(h, NameThreshold, v)
+	return err
+}
+
+// setRangedOption sets the numeric option of h named name to v, in the
+// units of the option (often UnitPercent), after checking v against its
+// range constraint. The value actually applied is returned.
+func setRangedOption(h SHandle, name SStringConst, v float64) (float64, error) {
+	_, d, err := FindOption(h, name)
+	if err != nil {
+		return 0, err
+	}
+	if d.Cap&Inactive != 0 {
+		return 0, &LibError{Op: "set " + string(name), Err: ErrOptionInactive}
+	}
+	if min, max, _, ok := d.RangeInfo(); ok && (v < min || v > max) {
+		return 0, Inval
+	}
+	applied, _, err := setFloatOption(h, name, v)
+	return applied, err
+}
+
+// SetBrightness sets the brightness option of h to v, in the units of the
+// option (often UnitPercent, from -100 to 100), and returns the value the
+// backend applied. Inval is returned if v is out of the option's range.
+func SetBrightness(h SHandle, v float64) (float64, error) {
+	return setRangedOption(h, NameBrightness, v)
+}
+
+// GetBrightness returns the value of the brightness option of h.
+func GetBrightness(h SHandle) (float64, error) {
+	v, _, err := getFloatOption(h, NameBrightness)
+	return v, err
+}
+
+// SetContrast is like SetBrightness, for the contrast option.
+func SetContrast(h SHandle, v float64) (float64, error) {
+	return setRangedOption(h, NameContrast, v)
+}
+
+// GetContrast returns the value of the contrast option of h.
+func GetContrast(h SHandle) (float64, error) {
+	v, _, err := getFloatOption(h, NameContrast)
+	return v, err
+}
+
+// percentOfRange maps pct (0-100) onto the range constraint of d, quantized
+// to the range's step. ok is false if d is not constrained by a range.
+func percentOfRange(d *OptionDescriptor, pct float64) (v float64, ok bool) {
+	min, max, quant, ok := d.RangeInfo()
+	if !ok {
+		return 0, false
+	}
+	v = min + pct/100*(max-min)
+	if quant > 0 {
+		steps := math.Round((v - min) / quant)
+		// The maximum need not be a whole number of steps from the minimum.
+		steps = math.Min(steps, math.Floor((max-min)/quant))
+		v = min + steps*quant
+	}
+	return math.Min(v, max), true
+}
+
+// SetOptionPercent sets the range constrained numeric option of h named name
+// to pct percent (0-100) of its range, quantized to the range's step. This
+// lets a generic slider drive any range option without knowing its unit.
+func SetOptionPercent(h SHandle, name SStringConst, pct float64) error {
+	if pct < 0 || pct > 100 {
+		return Inval
+	}
+	_, d, err := FindOption(h, name)
+	if err != nil {
+		return err
+	}
+	v, ok := percentOfRange(d, pct)
+	if !ok {
+		return Inval
+	}
+	_, _, err = setFloatOption(h, name, v)
+	return err
+}
+
+// getBoolOption returns the value of the boolean option named name.
+func getBoolOption(h SHandle, name SStringConst) (bool, error) {
+	n, d, err := FindOption(h, name)
+	if err != nil {
+		return false, err
+	}
+	if d.Type != TypeBool {
+		return false, typeMismatch(name)
+	}
+	v := []SWord{SFALSE}
+	if _, err := ControlOption(h, n, ActionGetValue, v); err != nil {
+		return false, err
+	}
+	return v[0] != SFALSE, nil
+}
+
+// setBoolOption sets the boolean option named name to v.
+func setBoolOption(h SHandle, name SStringConst, v bool) (Info, error) {
+	n, d, err := FindOption(h, name)
+	if err != nil {
+		return 0, err
+	}
+	if d.Type != TypeBool {
+		return 0, typeMismatch(name)
+	}
+	w := []SWord{SFALSE}
+	if v {
+		w[0] = STRUE
+	}
+	return ControlOption(h, n, ActionSetValue, w)
+}
+
+// trimNUL returns the bytes of b up to the first NUL as a string.
+func trimNUL(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+// getStringOption returns the value of the string option named name.
+func getStringOption(h SHandle, name SStringConst) (string, error) {
+	n, d, err := FindOption(h, name)
+	if err != nil {
+		return "", err
+	}
+	if d.Type != TypeString {
+		return "", typeMismatch(name)
+	}
+	v := make(SString, d.Size)
+	if _, err := ControlOption(h, n, ActionGetValue, v); err != nil {
+		return "", err
+	}
+	return v.Text(), nil
+}
+
+// setStringOption sets the string option named name to v.
+func setStringOption(h SHandle, name SStringConst, v string) (Info, error) {
+	n, d, err := FindOption(h, name)
+	if err != nil {
+		return 0, err
+	}
+	if d.Type != TypeString {
+		return 0, typeMismatch(name)
+	}
+	if SInt(len(v)) >= d.Size {
+		return 0, Inval
+	}
+	buf := make(SString, d.Size)
+	copy(buf, v)
+	return ControlOption(h, n, ActionSetValue, buf)
+}
+
+// getWordsOption returns the value of the word vector option named name.
+func getWordsOption(h SHandle, name SStringConst) ([]SWord, *OptionDescriptor, error) {
+	n, d, err := FindOption(h, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if d.Type != TypeBool && d.Type != TypeInt && d.Type != TypeFixed || d.Size < 4 {
+		return nil, d, typeMismatch(name)
+	}
+	v := make([]SWord, d.Size/4)
+	if _, err := ControlOption(h, n, ActionGetValue, v); err != nil {
+		return nil, d, err
+	}
+	return v, d, nil
+}
+
+// fixedVectorOption returns the number and descriptor of the TypeFixed
+// option of h named name.
+func fixedVectorOption(h SHandle, name SStringConst) (SInt, *OptionDescriptor, error) {
+	n, d, err := FindOption(h, name)
+	if err != nil {
+		return 0, nil, err
+	}
+	if d.Type != TypeFixed || d.Size < 4 {
+		return 0, nil, typeMismatch(name)
+	}
+	return n, d, nil
+}
+
+// GetFixedVector returns the value of the TypeFixed option of h named name
+// as floats, e.g. the points of a tone curve. It works for single values as
+// well as vectors.
+func GetFixedVector(h SHandle, name SStringConst) ([]float64, error) {
+	n, d, err := fixedVectorOption(h, name)
+	if err != nil {
+		return nil, err
+	}
+	v := make([]float64, d.Size/4)
+	if _, err := ControlOption(h, n, ActionGetValue, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// SetFixedVector sets the TypeFixed option of h named name to v, which must
+// have one element per element of the option. v is updated in place with
+// the values actually applied by the backend.
+func SetFixedVector(h SHandle, name SStringConst, v []float64) error {
+	n, d, err := fixedVectorOption(h, name)
+	if err != nil {
+		return err
+	}
+	if SInt(len(v)) != d.Size/4 {
+		return &LibError{Op: "option " + string(name), Err: fmt.Errorf("want %d values, got %d", d.Size/4, len(v))}
+	}
+	_, err = ControlOption(h, n, ActionSetValue, v)
+	return err
+}
+
+// GetOptionInto reads the value of the option of h named name into dst,
+// which must be one of:
+//
+//	*int      for TypeInt options
+//	*float64  for TypeInt and TypeFixed options
+//	*bool     for TypeBool options
+//	*string   for TypeString options
+//	*[]SWord  for the raw value of TypeBool, TypeInt and TypeFixed options
+//
+// A LibError wrapping ErrTypeMismatch is returned if dst does not match the
+// type of the option.
+func GetOptionInto(h SHandle, name SStringConst, dst interface{}) error {
+	_, d, err := FindOption(h, name)
+	if err != nil {
+		return err
+	}
+	switch dst := dst.(type) {
+	case *int:
+		if d.Type != TypeInt {
+			return typeMismatch(name)
+		}
+		v, _, err := getWordsOption(h, name)
+		if err != nil {
+			return err
+		}
+		*dst = int(v[0])
+	case *float64:
+		v, _, err := getFloatOption(h, name)
+		if err != nil {
+			return err
+		}
+		*dst = v
+	case *bool:
+		v, err := getBoolOption(h, name)
+		if err != nil {
+			return err
+		}
+		*dst = v
+	case *string:
+		v, err := getStringOption(h, name)
+		if err != nil {
+			return err
+		}
+		*dst = v
+	case *[]SWord:
+		v, _, err := getWordsOption(h, name)
+		if err != nil {
+			return err
+		}
+		*dst = v
+	default:
+		return typeMismatch(name)
+	}
+	return nil
+}
+
+// setStringListOption sets the string list constrained option named name to
+// the first allowed value for which match returns true, and returns it.
+// Unsupported is returned if no allowed value matches.
+func setStringListOption(h SHandle, name SStringConst, match func(string) bool) (string, error) {
+	_, d, err := FindOption(h, name)
+	if err != nil {
+		return "", err
+	}
+	for _, v := range d.StringList() {
+		if match(string(v)) {
+			_, err := setStringOption(h, name, string(v))
+			return string(v), err
+		}
+	}
+	return "", Unsupported
+}
+
+// MatchMode selects how SetColorMode and SetSource match the value asked
+// for against the values allowed by the device.
+type MatchMode int
+
+const (
+	// MatchExact requires the values to be identical.
+	MatchExact MatchMode = iota
+
+	// MatchFold compares the values ignoring case. This is the default.
+	MatchFold
+
+	// MatchSubstring accepts an allowed value containing the value asked
+	// for, ignoring case, so that e.g. "Color" selects "24bit Color". A
+	// value equal to the one asked for, ignoring case, is still preferred.
+	MatchSubstring
+)
+
+var (
+	matchModeMu sync.RWMutex
+	matchMode   = MatchFold
+)
+
+// SetStringMatchMode sets the MatchMode used by SetColorMode and SetSource.
+func SetStringMatchMode(m MatchMode) {
+	matchModeMu.Lock()
+	matchMode = m
+	matchModeMu.Unlock()
+}
+
+// setMatchingOption sets the string list option of h named name to the
+// allowed value matching want according to the current MatchMode.
+func setMatchingOption(h SHandle, name, want SStringConst) error {
+	matchModeMu.RLock()
+	m := matchMode
+	matchModeMu.RUnlock()
+
+	if m == MatchExact {
+		_, err := setStringListOption(h, name, func(v string) bool {
+			return v == string(want)
+		})
+		return err
+	}
+	_, err := setStringListOption(h, name, func(v string) bool {
+		return strings.EqualFold(v, string(want))
+	})
+	if err != Unsupported || m != MatchSubstring {
+		return err
+	}
+	_, err = setStringListOption(h, name, func(v string) bool {
+		return strings.Contains(strings.ToLower(v), strings.ToLower(string(want)))
+	})
+	return err
+}
+
+// SetColorMode sets the scan mode of h to mode (e.g. ValueScanModeColor),
+// matching the values allowed by the device according to the MatchMode set
+// with SetStringMatchMode, case-insensitively by default.
+func SetColorMode(h SHandle, mode SStringConst) error {
+	return setMatchingOption(h, NameScanMode, mode)
+}
+
+// SetSource sets the scan source of h to source (e.g.
+// ValueScanSourceFlatbed), matching the values allowed by the device
+// according to the MatchMode set with SetStringMatchMode, case-insensitively
+// by default.
+func SetSource(h SHandle, source SStringConst) error {
+	return setMatchingOption(h, NameScanSource, source)
+}
+
+// Keywords identifying the kind of a scan source in the values backends use,
+// e.g. "Automatic Document Feeder", "ADF Front" or "Transparency Adapter".
+var (
+	adfSourceWords          = []string{"adf", "feeder", "duplex", "simplex"}
+	transparencySourceWords = []string{"transparency", "tpu", "tma", "film", "slide", "negative", "positive"}
+	flatbedSourceWords      = []string{"flatbed", "platen", "normal", "document table", "glass"}
+)
+
+// containsAny reports whether s contains any of words.
+func containsAny(s string, words []string) bool {
+	for _, w := range words {
+		if strings.Contains(s, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// AvailableSources reports which kinds of scan source h offers, from the
+// values allowed by its source option, so that a GUI can e.g. hide its ADF
+// toggle. The varied backend spellings are normalized by keyword; values of
+// unknown kind, such as "Auto", are ignored. Devices without a source option
+// are assumed to be flatbeds.
+func AvailableSources(h SHandle) (flatbed, adf, transparency bool, err error) {
+	_, d, err := FindOption(h, NameScanSource)
+	if err == Unsupported {
+		return true, false, false, nil
+	}
+	if err != nil {
+		return false, false, false, err
+	}
+	for _, v := range d.StringList() {
+		s := strings.ToLower(string(v))
+		switch {
+		case containsAny(s, adfSourceWords):
+			adf = true
+		case containsAny(s, transparencySourceWords):
+			transparency = true
+		case containsAny(s, flatbedSourceWords):
+			flatbed = true
+		}
+	}
+	return flatbed, adf, transparency, nil
+}
+
+// displayDecimals is the number of decimals TypeFixed values are rounded to
+// by FormatOptionValue.
+const displayDecimals = 3
+
+// FormatOptionValue returns the current value of the option of h named name
+// formatted for display: booleans as "yes" or "no", fixed-point values
+// rounded to three decimals (so a resolution of 300 dpi renders as "300"),
+// and vectors as comma separated lists. Buttons and groups format as "".
+func FormatOptionValue(h SHandle, name SStringConst) (string, error) {
+	n, d, err := FindOption(h, name)
+	if err != nil {
+		return "", err
+	}
+	if !hasValue(d) {
+		return "", nil
+	}
+	v, err := getOptionValue(h, n, d)
+	if err != nil {
+		return "", err
+	}
+	if d.Type == TypeString {
+		return v.str, nil
+	}
+	parts := make([]string, len(v.words))
+	for i, w := range v.words {
+		switch d.Type {
+		case TypeBool:
+			parts[i] = "no"
+			if w != SFALSE {
+				parts[i] = "yes"
+			}
+		case TypeFixed:
+			parts[i] = strconv.FormatFloat(SFixed(w).Round(displayDecimals), 'f', -1, 64)
+		default:
+			parts[i] = strconv.Itoa(int(w))
+		}
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// RefreshOption fetches the descriptor of option index of h again, e.g. after
+// setting another option reported ReloadOptions, since the constraint of
+// an option (such as the resolutions allowed) may depend on other options.
+// gosane does not cache descriptors, so GetOptionDescriptor always returns
+// current ones too; RefreshOption additionally reports a missing option as
+// Inval rather than nil.
+func RefreshOption(h SHandle, index int) (*OptionDescriptor, error) {
+	if err := checkInit("RefreshOption"); err != nil {
+		return nil, err
+	}
+	d := GetOptionDescriptor(h, SInt(index))
+	if d == nil {
+		return nil, Inval
+	}
+	return d, nil
+}
+
+// ActiveOptions returns the descriptors of the options of h that are
+// currently active, excluding groups; that is, the options a user can
+// actually deal with given the current settings. Setting an option that
+// reports ReloadOptions may change the result.
+func ActiveOptions(h SHandle) ([]*OptionDescriptor, error) {
+	ds, err := GetOptionDescriptors(h)
+	if err != nil {
+		return nil, err
+	}
+	var active []*OptionDescriptor
+	for n := 1; n < len(ds); n++ {
+		if d := ds[n]; d != nil && d.Type != TypeGroup && d.Cap&Inactive == 0 {
+			active = append(active, d)
+		}
+	}
+	return active, nil
+}
@@ -0,0 +1,445 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRefreshOption(t *testing.T) {
+	f := newFakeBackend()
+	mode := f.option(NameScanMode)
+	res := f.option(NameScanResolution)
+	// Lineart is only available up to 150 dpi.
+	f.onSet = func(n SInt) Info {
+		if f.opts[n] != mode {
+			return 0
+		}
+		if mode.str == "Lineart" {
+			res.desc.Constraint = WordListConstraint{75, 150}
+		} else {
+			res.desc.Constraint = WordListConstraint{75, 150, 300}
+		}
+		return ReloadOptions
+	}
+	h := setupFake(t, f)
+	defer Exit()
+
+	n, _, err := FindOption(h, NameScanResolution)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetColorMode(h, "Lineart"); err != nil {
+		t.Fatal(err)
+	}
+	d, err := RefreshOption(h, int(n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := d.Constraint, (WordListConstraint{75, 150}); !reflect.DeepEqual(got, want) {
+		t.Errorf("resolutions in lineart mode %v, want %v", got, want)
+	}
+	if _, err := RefreshOption(h, len(f.opts)); err != Inval {
+		t.Errorf("RefreshOption of a missing option = %v, want Inval", err)
+	}
+}
+
+func TestRangeInfo(t *testing.T) {
+	for _, c := range []struct {
+		name            string
+		d               OptionDescriptor
+		min, max, quant float64
+		ok              bool
+	}{
+		{"int", OptionDescriptor{Type: TypeInt, Constraint: RangeConstraint{SRange{Min: 50, Max: 1200, Quant: 25}}}, 50, 1200, 25, true},
+		{"fixed", OptionDescriptor{Type: TypeFixed, Constraint: RangeConstraint{SRange{
+			Min: SWord(FloatToFixed(-1.5)), Max: SWord(FloatToFixed(215.5)), Quant: SWord(FloatToFixed(0.25))}}}, -1.5, 215.5, 0.25, true},
+		{"word list", OptionDescriptor{Type: TypeInt, Constraint: WordListConstraint{75, 150}}, 0, 0, 0, false},
+		{"none", OptionDescriptor{Type: TypeInt}, 0, 0, 0, false},
+	} {
+		min, max, quant, ok := c.d.RangeInfo()
+		if min != c.min || max != c.max || quant != c.quant || ok != c.ok {
+			t.Errorf("%s: RangeInfo = %v, %v, %v, %v; want %v, %v, %v, %v", c.name, min, max, quant, ok, c.min, c.max, c.quant, c.ok)
+		}
+	}
+}
+
+func TestGetOptionInto(t *testing.T) {
+	f := newFakeBackend()
+	f.addOption(OptionDescriptor{Name: NamePreview, Type: TypeBool, Size: 4, Cap: SoftSelect | SoftDetect}, STRUE)
+	h := setupFake(t, f)
+	defer Exit()
+
+	var (
+		i     int
+		fl    float64
+		b     bool
+		s     string
+		words []SWord
+	)
+	for _, c := range []struct {
+		name SStringConst
+		dst  interface{}
+	}{
+		{NameScanResolution, &i},
+		{NameScanBRX, &fl},
+		{NamePreview, &b},
+		{NameScanMode, &s},
+		{NameScanResolution, &words},
+	} {
+		if err := GetOptionInto(h, c.name, c.dst); err != nil {
+			t.Errorf("GetOptionInto(%s, %T): %v", c.name, c.dst, err)
+		}
+	}
+	if i != 300 || fl != FixedToFloat(FloatToFixed(215.9)) || !b || s != "Color" || !reflect.DeepEqual(words, []SWord{300}) {
+		t.Errorf("read %v, %v, %v, %q, %v", i, fl, b, s, words)
+	}
+
+	var res float64
+	if err := GetOptionInto(h, NameScanResolution, &res); err != nil || res != 300 {
+		t.Errorf("resolution read as float64 = %v, %v", res, err)
+	}
+	for _, c := range []struct {
+		name SStringConst
+		dst  interface{}
+	}{
+		{NameScanBRX, &i},
+		{NameScanMode, &b},
+		{NameScanResolution, &s},
+		{NameScanResolution, new(uint8)},
+	} {
+		if err := GetOptionInto(h, c.name, c.dst); !errors.Is(err, ErrTypeMismatch) {
+			t.Errorf("GetOptionInto(%s, %T) = %v, want ErrTypeMismatch", c.name, c.dst, err)
+		}
+	}
+}
+
+func TestSetOptionPercent(t *testing.T) {
+	f := newFakeBackend()
+	f.addOption(OptionDescriptor{Name: NameBrightness, Type: TypeInt, Size: 4, Cap: SoftSelect | SoftDetect,
+		Constraint: RangeConstraint{SRange{Min: -100, Max: 100, Quant: 1}}}, 0)
+	f.addOption(OptionDescriptor{Name: NameContrast, Type: TypeInt, Size: 4, Cap: SoftSelect | SoftDetect,
+		Constraint: RangeConstraint{SRange{Min: 0, Max: 255, Quant: 10}}}, 0)
+	h := setupFake(t, f)
+	defer Exit()
+
+	for _, c := range []struct {
+		name SStringConst
+		pct  float64
+		want SWord
+	}{
+		{NameBrightness, 50, 0},
+		{NameBrightness, 0, -100},
+		{NameBrightness, 100, 100},
+		{NameBrightness, 25, -50},
+		{NameContrast, 50, 130}, // 127.5 quantized to the step of 10
+		{NameContrast, 100, 250},
+	} {
+		if err := SetOptionPercent(h, c.name, c.pct); err != nil {
+			t.Fatal(err)
+		}
+		if got := f.option(c.name).words[0]; got != c.want {
+			t.Errorf("%s at %v%% = %d, want %d", c.name, c.pct, got, c.want)
+		}
+	}
+	// The fixed-point bottom-right x ranges from 0 to 215.9 mm.
+	if err := SetOptionPercent(h, NameScanBRX, 50); err != nil {
+		t.Fatal(err)
+	}
+	if got := SFixed(f.option(NameScanBRX).words[0]).Round(2); got != 107.95 {
+		t.Errorf("br-x at 50%% = %v, want 107.95", got)
+	}
+
+	if err := SetOptionPercent(h, NameBrightness, 101); err != Inval {
+		t.Errorf("SetOptionPercent(101) = %v, want Inval", err)
+	}
+	if err := SetOptionPercent(h, NameScanResolution, 50); err != Inval {
+		t.Errorf("SetOptionPercent of a word list option = %v, want Inval", err)
+	}
+}
+
+func TestFormatOptionValueRounding(t *testing.T) {
+	f := newFakeBackend()
+	// 300 dpi as reported by a backend computing it in fixed point.
+	f.addOption(OptionDescriptor{Name: NameScanXRes, Type: TypeFixed, Unit: UnitDpi, Size: 4,
+		Cap: SoftSelect | SoftDetect}, SWord(300<<16-13))
+	f.addOption(OptionDescriptor{Name: "gamma", Type: TypeFixed, Size: 4, Cap: SoftSelect | SoftDetect},
+		SWord(FloatToFixed(1.8)))
+	h := setupFake(t, f)
+	defer Exit()
+
+	if v := FixedToFloat(SFixed(f.option(NameScanXRes).words[0])); v == 300 {
+		t.Fatalf("stored resolution %v is exact", v)
+	}
+	for name, want := range map[SStringConst]string{NameScanXRes: "300", "gamma": "1.8", NameScanResolution: "300"} {
+		if got, err := FormatOptionValue(h, name); got != want || err != nil {
+			t.Errorf("FormatOptionValue(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+
+	for _, c := range []struct {
+		f        SFixed
+		decimals int
+		want     float64
+	}{
+		{300<<16 - 13, 0, 300},
+		{300<<16 - 13, 3, 300},
+		{FloatToFixed(215.9), 1, 215.9},
+		{FloatToFixed(-1.25), 1, -1.3},
+		{FloatToFixed(0.5), 0, 1},
+	} {
+		if got := c.f.Round(c.decimals); got != c.want {
+			t.Errorf("%v.Round(%d) = %v, want %v", FixedToFloat(c.f), c.decimals, got, c.want)
+		}
+	}
+}
+
+func TestFindOptionByTitle(t *testing.T) {
+	f := newFakeBackend()
+	f.option(NameScanResolution).desc.Title = "Scan resolution"
+	f.option(NameScanMode).desc.Title = "Scan mode"
+	f.addOption(OptionDescriptor{Name: "red-gain", Title: "Gain", Type: TypeInt, Size: 4, Cap: SoftSelect | SoftDetect}, 1)
+	f.addOption(OptionDescriptor{Name: "blue-gain", Title: "gain", Type: TypeInt, Size: 4, Cap: SoftSelect | SoftDetect}, 1)
+	h := setupFake(t, f)
+	defer Exit()
+
+	n, d, err := FindOptionByTitle(h, "SCAN MODE")
+	if err != nil || d.Name != NameScanMode {
+		t.Fatalf("FindOptionByTitle = %d, %v, %v", n, d, err)
+	}
+	if _, _, err := FindOptionByTitle(h, "Gain"); !errors.Is(err, ErrAmbiguousTitle) {
+		t.Errorf("shared title: %v, want ErrAmbiguousTitle", err)
+	}
+	if _, _, err := FindOptionByTitle(h, "Brightness"); err != Unsupported {
+		t.Errorf("unknown title: %v, want Unsupported", err)
+	}
+
+	// SetOptions falls back to titles for keys that are not option names.
+	if err := SetOptions(h, map[string]string{"scan resolution": "150", "mode": "Gray"}); err != nil {
+		t.Fatal(err)
+	}
+	if r, m := f.option(NameScanResolution).words[0], f.option(NameScanMode).str; r != 150 || m != "Gray" {
+		t.Errorf("set resolution %d and mode %q, want 150 and Gray", r, m)
+	}
+	if err := SetOptions(h, map[string]string{"gain": "2"}); !errors.Is(err, ErrAmbiguousTitle) {
+		t.Errorf("SetOptions with a shared title: %v, want ErrAmbiguousTitle", err)
+	}
+}
+
+func TestActiveOptions(t *testing.T) {
+	f := lineartFake()
+	f.addOption(OptionDescriptor{Title: "Advanced", Type: TypeGroup}, nil)
+	h := setupFake(t, f)
+	defer Exit()
+	names := func() []SStringConst {
+		ds, err := ActiveOptions(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []SStringConst
+		for _, d := range ds {
+			names = append(names, d.Name)
+		}
+		return names
+	}
+
+	geometry := []SStringConst{NameScanTLX, NameScanTLY, NameScanBRX, NameScanBRY}
+	want := append([]SStringConst{NameScanResolution, NameScanMode}, geometry...)
+	if got := names(); !reflect.DeepEqual(got, want) {
+		t.Errorf("active in color mode: %q, want %q", got, want)
+	}
+	if err := SetOptions(h, map[string]string{"mode": "Lineart"}); err != nil {
+		t.Fatal(err)
+	}
+	want = append([]SStringConst{NameThreshold, NameScanResolution, NameScanMode}, geometry...)
+	if got := names(); !reflect.DeepEqual(got, want) {
+		t.Errorf("active in lineart mode: %q, want %q", got, want)
+	}
+}
+
+func TestAvailableSources(t *testing.T) {
+	h := setupFake(t, newFakeBackend())
+	if flatbed, adf, tpu, err := AvailableSources(h); !flatbed || adf || tpu || err != nil {
+		t.Errorf("without a source option = %v, %v, %v, %v; want a flatbed", flatbed, adf, tpu, err)
+	}
+	Exit()
+
+	for _, c := range []struct {
+		sources           StringListConstraint
+		flatbed, adf, tpu bool
+	}{
+		{StringListConstraint{"Flatbed", "ADF"}, true, true, false},
+		{StringListConstraint{"Flatbed", "Automatic Document Feeder", "Transparency Adapter"}, true, true, true},
+		{StringListConstraint{"Normal", "ADF Front", "ADF Back", "ADF Duplex"}, true, true, false},
+		{StringListConstraint{"ADF Duplex"}, false, true, false},
+		{StringListConstraint{"Document Table", "TPU8x10"}, true, false, true},
+		{StringListConstraint{"Auto", "Film"}, false, false, true},
+	} {
+		f := newFakeBackend()
+		f.addOption(OptionDescriptor{Name: NameScanSource, Type: TypeString, Size: 32, Cap: SoftSelect | SoftDetect,
+			Constraint: c.sources}, string(c.sources[0]))
+		h := setupFake(t, f)
+		flatbed, adf, tpu, err := AvailableSources(h)
+		if err != nil || flatbed != c.flatbed || adf != c.adf || tpu != c.tpu {
+			t.Errorf("sources %q = %v, %v, %v, %v; want %v, %v, %v", c.sources, flatbed, adf, tpu, err, c.flatbed, c.adf, c.tpu)
+		}
+		Exit()
+	}
+}
+
+func TestFixedVector(t *testing.T) {
+	f := newFakeBackend()
+	curve := f.addOption(OptionDescriptor{Name: "tone-curve", Type: TypeFixed, Size: 4 * 8, Cap: SoftSelect | SoftDetect,
+		Constraint: RangeConstraint{SRange{Max: SWord(FloatToFixed(1))}}}, SWord(0))
+	h := setupFake(t, f)
+	defer Exit()
+
+	set := []float64{0, 0.1, 0.25, 0.4, 0.55, 0.7, 0.85, 1}
+	if err := SetFixedVector(h, "tone-curve", set); err != nil {
+		t.Fatal(err)
+	}
+	got, err := GetFixedVector(h, "tone-curve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make([]float64, len(set))
+	for i, v := range set {
+		want[i] = FixedToFloat(FloatToFixed(v))
+		if w := f.option("tone-curve").words[i]; w != SWord(FloatToFixed(v)) {
+			t.Errorf("element %d stored as %#x, want %#x", i, w, FloatToFixed(v))
+		}
+	}
+	if !reflect.DeepEqual(got, want) || !reflect.DeepEqual(set, want) {
+		t.Errorf("curve read back as %v and applied as %v, want %v", got, set, want)
+	}
+
+	// ControlOption takes []float64 buffers directly.
+	buf := make([]float64, 8)
+	if _, err := ControlOption(h, curve, ActionGetValue, buf); err != nil || !reflect.DeepEqual(buf, want) {
+		t.Errorf("ControlOption read %v, %v", buf, err)
+	}
+
+	var le *LibError
+	if err := SetFixedVector(h, "tone-curve", set[:4]); !errors.As(err, &le) {
+		t.Errorf("SetFixedVector with 4 of 8 values = %v, want a LibError", err)
+	}
+	if _, err := GetFixedVector(h, NameScanResolution); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("GetFixedVector of an int option = %v, want ErrTypeMismatch", err)
+	}
+	if g, err := GetFixedVector(h, NameScanBRX); err != nil || len(g) != 1 || g[0] != FixedToFloat(FloatToFixed(215.9)) {
+		t.Errorf("GetFixedVector of a single value = %v, %v", g, err)
+	}
+}
+
+func TestBrightnessContrast(t *testing.T) {
+	f := newFakeBackend()
+	f.addOption(OptionDescriptor{Name: NameBrightness, Type: TypeInt, Unit: UnitPercent, Size: 4, Cap: SoftSelect | SoftDetect,
+		Constraint: RangeConstraint{SRange{Min: -100, Max: 100, Quant: 1}}}, 0)
+	f.addOption(OptionDescriptor{Name: NameContrast, Type: TypeFixed, Unit: UnitPercent, Size: 4, Cap: SoftSelect | SoftDetect,
+		Constraint: RangeConstraint{SRange{Min: SWord(FloatToFixed(-50)), Max: SWord(FloatToFixed(50))}}}, SWord(0))
+	h := setupFake(t, f)
+	defer Exit()
+
+	if v, err := SetBrightness(h, 12.6); v != 13 || err != nil {
+		t.Errorf("SetBrightness(12.6) = %v, %v; want 13 applied", v, err)
+	}
+	if v, err := GetBrightness(h); v != 13 || err != nil {
+		t.Errorf("GetBrightness = %v, %v; want 13", v, err)
+	}
+	if v, err := SetContrast(h, -20.5); v != -20.5 || err != nil {
+		t.Errorf("SetContrast(-20.5) = %v, %v", v, err)
+	}
+	if w := f.option(NameContrast).words[0]; w != SWord(FloatToFixed(-20.5)) {
+		t.Errorf("contrast stored as %#x, want fixed-point -20.5", w)
+	}
+	if v, err := GetContrast(h); v != -20.5 || err != nil {
+		t.Errorf("GetContrast = %v, %v; want -20.5", v, err)
+	}
+
+	if _, err := SetBrightness(h, 101); err != Inval {
+		t.Errorf("SetBrightness(101) = %v, want Inval", err)
+	}
+	if _, err := SetContrast(h, -50.5); err != Inval {
+		t.Errorf("SetContrast(-50.5) = %v, want Inval", err)
+	}
+	if v, _ := GetBrightness(h); v != 13 {
+		t.Errorf("out of range brightness changed it to %v", v)
+	}
+	f.option(NameContrast).desc.Cap |= Inactive
+	if _, err := SetContrast(h, 10); !errors.Is(err, ErrOptionInactive) {
+		t.Errorf("SetContrast of an inactive option = %v, want ErrOptionInactive", err)
+	}
+	Exit()
+
+	h = setupFake(t, newFakeBackend())
+	if _, err := SetBrightness(h, 10); err != Unsupported {
+		t.Errorf("SetBrightness without the option = %v, want Unsupported", err)
+	}
+}
+
+func TestSetStringMatchMode(t *testing.T) {
+	f := newFakeBackend()
+	mode := f.option(NameScanMode)
+	mode.desc.Constraint = StringListConstraint{"Black & White", "24bit Color", "color"}
+	h := setupFake(t, f)
+	defer Exit()
+	defer SetStringMatchMode(MatchFold)
+
+	for _, c := range []struct {
+		m    MatchMode
+		ask  SStringConst
+		want string
+		err  error
+	}{
+		{MatchExact, "color", "color", nil},
+		{MatchExact, "Color", "", Unsupported},
+		{MatchFold, "COLOR", "color", nil},
+		{MatchFold, "White", "", Unsupported},
+		{MatchSubstring, "Color", "color", nil}, // an exact match is preferred
+		{MatchSubstring, "24BIT", "24bit Color", nil},
+		{MatchSubstring, "white", "Black & White", nil},
+	} {
+		mode.str = ""
+		SetStringMatchMode(c.m)
+		err := SetColorMode(h, c.ask)
+		if err != c.err || mode.str != c.want {
+			t.Errorf("mode %d: SetColorMode(%q) = %v, set %q; want %v, %q", c.m, c.ask, err, mode.str, c.err, c.want)
+		}
+	}
+
+	// Without the exact value, substring matching picks "24bit Color".
+	mode.desc.Constraint = StringListConstraint{"Lineart", "8bit Gray", "24bit Color"}
+	if err := SetColorMode(h, ValueScanModeColor); err != nil || mode.str != "24bit Color" {
+		t.Errorf("SetColorMode(Color) = %v, set %q; want 24bit Color", err, mode.str)
+	}
+}
+
+func TestHasOption(t *testing.T) {
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	defer Exit()
+
+	for _, c := range []struct {
+		name SStringConst
+		want bool
+	}{
+		{NameScanMode, true},
+		{NameScanBRY, true},
+		{NameScanSource, false},
+		{"", false},
+	} {
+		if has, err := HasOption(h, c.name); has != c.want || err != nil {
+			t.Errorf("HasOption(%q) = %v, %v; want %v, nil", c.name, has, err, c.want)
+		}
+	}
+
+	// Failing to read the options is an error, not an absent option.
+	f.controlErr = IoError
+	if has, err := HasOption(h, NameScanMode); has || err != IoError {
+		t.Errorf("HasOption with a failing device = %v, %v; want false, IoError", has, err)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"strconv"
+)
+
+// pdfWriter writes numbered PDF objects to w, keeping track of their offsets
+// for the cross-reference table. The first error encountered is sticky.
+type pdfWriter struct {
+	w       io.Writer
+	n       int64
+	offsets map[int]int64
+	err     error
+}
+
+func newPDFWriter(w io.Writer) *pdfWriter {
+	pw := &pdfWriter{w: w, offsets: make(map[int]int64)}
+	pw.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	return pw
+}
+
+func (pw *pdfWriter) write(b []byte) {
+	if pw.err != nil {
+		return
+	}
+	n, err := pw.w.Write(b)
+	pw.n += int64(n)
+	pw.err = err
+}
+
+func (pw *pdfWriter) printf(format string, v ...interface{}) {
+	pw.write([]byte(fmt.Sprintf(format, v...)))
+}
+
+// object writes object num with the given dictionary body.
+func (pw *pdfWriter) object(num int, dict string) {
+	pw.offsets[num] = pw.n
+	pw.printf("%d 0 obj\n%s\nendobj\n", num, dict)
+}
+
+// stream writes object num as a stream with the given extra dictionary
+// entries.
+func (pw *pdfWriter) stream(num int, dict string, data []byte) {
+	if dict != "" {
+		dict += " "
+	}
+	pw.offsets[num] = pw.n
+	pw.printf("%d 0 obj\n<< %s/Length %d >>\nstream\n", num, dict, len(data))
+	pw.write(data)
+	pw.printf("\nendstream\nendobj\n")
+}
+
+// finish writes the cross-reference table and trailer for objects 1 through
+// count, with object root as the document catalog.
+func (pw *pdfWriter) finish(count, root int) error {
+	xref := pw.n
+	pw.printf("xref\n0 %d\n0000000000 65535 f \n", count+1)
+	for num := 1; num <= count; num++ {
+		pw.printf("%010d 00000 n \n", pw.offsets[num])
+	}
+	pw.printf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", count+1, root, xref)
+	return pw.err
+}
+
+// pdfNum formats v as a PDF number with at most two decimals.
+func pdfNum(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+// isBilevel reports whether img is a gray image containing only black and
+// white pixels.
+func isBilevel(img image.Image) bool {
+	if !isGray(img) {
+		return false
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if v, _, _, _ := img.At(x, y).RGBA(); v != 0 && v != 0xffff {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// pdfImage encodes img as the data of a PDF image XObject and returns it
+// along with the dictionary entries describing it. Bilevel images are packed
+// to one bit per pixel and Flate compressed; all others are JPEG compressed.
+func pdfImage(img image.Image) (string, []byte, error) {
+	b := img.Bounds()
+	var buf bytes.Buffer
+	if isBilevel(img) {
+		stride := (b.Dx() + 7) / 8
+		packed := make([]byte, stride*b.Dy())
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				if v, _, _, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA(); v != 0 {
+					packed[y*stride+x/8] |= 0x80 >> uint(x%8)
+				}
+			}
+		}
+		zw := zlib.NewWriter(&buf)
+		if _, err := zw.Write(packed); err != nil {
+			return "", nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return "", nil, err
+		}
+		dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 1 /Filter /FlateDecode", b.Dx(), b.Dy())
+		return dict, buf.Bytes(), nil
+	}
+
+	cs := "/DeviceRGB"
+	if isGray(img) {
+		cs = "/DeviceGray"
+	}
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		return "", nil, err
+	}
+	dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /DCTDecode", b.Dx(), b.Dy(), cs)
+	return dict, buf.Bytes(), nil
+}
+
+// page writes the page, content and image objects of img as objects
+// num, num+1 and num+2, with parent as the page tree.
+func (pw *pdfWriter) page(num, parent int, img image.Image, dpi float64) {
+	dict, data, err := pdfImage(img)
+	if err != nil {
+		if pw.err == nil {
+			pw.err = err
+		}
+		return
+	}
+	b := img.Bounds()
+	width, height := pdfNum(float64(b.Dx())*72/dpi), pdfNum(float64(b.Dy())*72/dpi)
+	pw.object(num, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>",
+		parent, width, height, num+2, num+1))
+	content := fmt.Sprintf("q %s 0 0 %s 0 0 cm /Im0 Do Q", width, height)
+	pw.stream(num+1, "", []byte(content))
+	pw.stream(num+2, dict, data)
+}
+
+// Object numbers of the document catalog and page tree, and of the first
+// page; each page takes three objects.
+const (
+	pdfCatalog   = 1
+	pdfPageTree  = 2
+	pdfFirstPage = 3
+)
+
+// PDFStream writes a PDF document one page at a time, so that memory use
+// stays bounded however many pages are scanned, e.g. from a large document
+// feeder batch. Each page is written out by AddPage; the document is
+// completed by Close.
+type PDFStream struct {
+	pw    *pdfWriter
+	dpi   float64
+	kids  bytes.Buffer
+	pages int
+}
+
+// NewPDFStream starts a PDF document written to w whose pages are sized to
+// the physical size of their images scanned at dpi.
+func NewPDFStream(w io.Writer, dpi float64) (*PDFStream, error) {
+	if dpi <= 0 {
+		return nil, Inval
+	}
+	s := &PDFStream{pw: newPDFWriter(w), dpi: dpi}
+	return s, s.pw.err
+}
+
+// AddPage writes img as the next page of the document. Bilevel pages are
+// stored losslessly with Flate compression and all other pages are stored
+// as JPEG.
+func (s *PDFStream) AddPage(img image.Image) error {
+	num := pdfFirstPage + 3*s.pages
+	s.pw.page(num, pdfPageTree, img, s.dpi)
+	if s.pw.err != nil {
+		return s.pw.err
+	}
+	fmt.Fprintf(&s.kids, "%d 0 R ", num)
+	s.pages++
+	return nil
+}
+
+// Close writes the page tree and cross-reference table that complete the
+// document. It does not close the underlying writer. Inval is returned if
+// no page was added.
+func (s *PDFStream) Close() error {
+	if s.pages == 0 {
+		return Inval
+	}
+	s.pw.object(pdfCatalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pdfPageTree))
+	s.pw.object(pdfPageTree, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", s.kids.String(), s.pages))
+	return s.pw.finish(pdfFirstPage+3*s.pages-1, pdfCatalog)
+}
+
+// WritePDF writes pages to w as a PDF document with one page per image, as
+// done by PDFStream.
+func WritePDF(w io.Writer, pages []image.Image, dpi float64) error {
+	if len(pages) == 0 {
+		return Inval
+	}
+	s, err := NewPDFStream(w, dpi)
+	if err != nil {
+		return err
+	}
+	for _, img := range pages {
+		if err := s.AddPage(img); err != nil {
+			return err
+		}
+	}
+	return s.Close()
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"math/rand"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+// heapInUse returns the bytes of live heap objects after a collection.
+func heapInUse() uint64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+func TestPDFStreamMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("writes 50 MB of pages")
+	}
+	// A 1 MiB page of noise, which compression cannot shrink, so that
+	// keeping any page alive would show.
+	page := image.NewGray(image.Rect(0, 0, 1024, 1024))
+	rand.New(rand.NewSource(1)).Read(page.Pix)
+
+	s, err := NewPDFStream(ioutil.Discard, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var base uint64
+	for i := 0; i < 50; i++ {
+		if err := s.AddPage(page); err != nil {
+			t.Fatal(err)
+		}
+		if i == 4 {
+			base = heapInUse()
+		}
+	}
+	if grown := int64(heapInUse()) - int64(base); grown > 256<<10 {
+		t.Errorf("heap grew by %d bytes over 45 pages", grown)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkXref checks that the cross-reference table of pdf points at its
+// objects, and returns the number of objects.
+func checkXref(t *testing.T, pdf []byte) int {
+	t.Helper()
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(pdf)
+	if m == nil {
+		t.Fatal("no startxref at the end of the PDF")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	var count int
+	if _, err := fmt.Sscanf(string(pdf[xref:]), "xref\n0 %d\n", &count); err != nil {
+		t.Fatalf("startxref does not point at the xref table: %v", err)
+	}
+	offsets := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	if len(offsets) != count-1 {
+		t.Fatalf("xref lists %d objects, want %d", len(offsets), count-1)
+	}
+	for i, o := range offsets {
+		off, _ := strconv.Atoi(string(o[1]))
+		if want := fmt.Sprintf("%d 0 obj", i+1); !bytes.HasPrefix(pdf[off:], []byte(want)) {
+			t.Errorf("xref entry of object %d does not point at it", i+1)
+		}
+	}
+	return count - 1
+}
+
+func TestWritePDF(t *testing.T) {
+	bilevel := image.NewGray(image.Rect(0, 0, 300, 150))
+	for i := range bilevel.Pix {
+		bilevel.Pix[i] = byte(i%2) * 0xff
+	}
+	pages := []image.Image{
+		bilevel,
+		image.NewRGBA(image.Rect(0, 0, 150, 300)),
+		image.NewGray(image.Rect(0, 0, 1240, 1754)), // A4
+	}
+	var buf bytes.Buffer
+	if err := WritePDF(&buf, pages, 150); err != nil {
+		t.Fatal(err)
+	}
+	pdf := buf.Bytes()
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		t.Fatal("no PDF header")
+	}
+	if n := checkXref(t, pdf); n != 2+3*len(pages) {
+		t.Errorf("PDF has %d objects, want %d", n, 2+3*len(pages))
+	}
+	if !bytes.Contains(pdf, []byte("/Count 3 ")) {
+		t.Error("page tree does not count 3 pages")
+	}
+	var boxes []string
+	for _, m := range regexp.MustCompile(`/MediaBox \[0 0 ([\d.]+ [\d.]+)\]`).FindAllSubmatch(pdf, -1) {
+		boxes = append(boxes, string(m[1]))
+	}
+	if want := []string{"144.00 72.00", "72.00 144.00", "595.20 841.92"}; !reflect.DeepEqual(boxes, want) {
+		t.Errorf("media boxes %q, want %q", boxes, want)
+	}
+	if !bytes.Contains(pdf, []byte("/BitsPerComponent 1 /Filter /FlateDecode")) {
+		t.Error("bilevel page not stored as a 1-bit image")
+	}
+
+	if err := WritePDF(&buf, nil, 150); err != Inval {
+		t.Errorf("WritePDF of no pages = %v, want Inval", err)
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package gosane
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// fdReadable reports whether fd is readable, without blocking.
+func fdReadable(fd int) (bool, error) {
+	var set syscall.FdSet
+	bits := int(unsafe.Sizeof(set.Bits[0])) * 8
+	if fd < 0 || fd >= len(set.Bits)*bits {
+		return false, Inval
+	}
+	for {
+		set.Bits[fd/bits] |= 1 << uint(fd%bits)
+		n, err := syscall.Select(fd+1, &set, nil, nil, &syscall.Timeval{})
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		return n > 0, nil
+	}
+}
@@ -0,0 +1,14 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package gosane
+
+// fdReadable reports whether fd is readable, without blocking. Polling is
+// only implemented on linux.
+func fdReadable(fd int) (bool, error) {
+	return false, Unsupported
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"sync"
+)
+
+// Pool keeps one open Scanner per device for services scanning from several
+// (typically networked) devices, so that devices are not reopened for every
+// job. Devices are opened lazily on first use.
+type Pool struct {
+	mu      sync.Mutex
+	entries map[string]*poolEntry
+}
+
+type poolEntry struct {
+	s     *Scanner
+	inUse bool
+}
+
+// NewPool returns a Pool for the devices named names.
+func NewPool(names []string) *Pool {
+	p := &Pool{entries: make(map[string]*poolEntry)}
+	for _, name := range names {
+		p.entries[name] = &poolEntry{}
+	}
+	return p
+}
+
+// healthy reports whether s still responds, by reading its option count.
+// A closed Scanner is not healthy; otherwise only an IoError counts as a
+// failed health check.
+func healthy(s *Scanner) bool {
+	h, err := s.handle("Acquire")
+	if err != nil {
+		return false
+	}
+	_, err = optionCount(h)
+	return err != IoError
+}
+
+// Acquire returns the Scanner of the device named name for exclusive use
+// until it is given back with Release. The device is opened if needed, and
+// reopened if its Scanner was closed, e.g. under the CloseOnError policy, or
+// fails a health check with an IoError. Inval is returned for devices not in
+// the pool and DeviceBusy if the Scanner is already acquired.
+func (p *Pool) Acquire(name string) (*Scanner, error) {
+	p.mu.Lock()
+	e, ok := p.entries[name]
+	if !ok {
+		p.mu.Unlock()
+		return nil, Inval
+	}
+	if e.inUse {
+		p.mu.Unlock()
+		return nil, DeviceBusy
+	}
+	// Reserve the entry, so that the device can be checked and opened
+	// without holding p.mu, which would hold up the other devices.
+	e.inUse = true
+	s := e.s
+	p.mu.Unlock()
+
+	var err error
+	if s != nil {
+		// A Scanner closed under its CloseOnError policy is reopened
+		// before its health check, rather than probed through a freed
+		// handle.
+		if _, cerr := s.handle("Acquire"); cerr != nil || s.NeedsReopen() {
+			err = s.Reopen()
+		}
+		if err == nil && !healthy(s) {
+			s.Close()
+			s = nil
+		}
+	}
+	if err == nil && s == nil {
+		s, err = OpenScanner(SStringConst(name))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		e.s, e.inUse = nil, false
+		return nil, err
+	}
+	e.s = s
+	return s, nil
+}
+
+// Release gives s, acquired from p, back to the pool.
+func (p *Pool) Release(s *Scanner) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e, ok := p.entries[string(s.Name())]; ok && e.s == s {
+		e.inUse = false
+	}
+}
+
+// Close closes every Scanner opened by p, including acquired ones.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, e := range p.entries {
+		if e.s != nil {
+			e.s.Close()
+			e.s = nil
+		}
+		e.inUse = false
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPoolReuse(t *testing.T) {
+	f := newFakeBackend()
+	SetBackend(f)
+	Init(0, nil)
+	defer Exit()
+	p := NewPool([]string{"fake:0"})
+	defer p.Close()
+
+	s, err := p.Acquire("fake:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Acquire("fake:0"); err != DeviceBusy {
+		t.Errorf("second Acquire = %v, want DeviceBusy", err)
+	}
+	if _, err := p.Acquire("fake:1"); err != Inval {
+		t.Errorf("Acquire of an unknown device = %v, want Inval", err)
+	}
+	p.Release(s)
+	s2, err := p.Acquire("fake:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s2 != s || countCalls(f, "Open") != 1 {
+		t.Error("released Scanner not reused")
+	}
+}
+
+func TestPoolReopenOnIoError(t *testing.T) {
+	f := newFakeBackend()
+	SetBackend(f)
+	Init(0, nil)
+	defer Exit()
+	p := NewPool([]string{"fake:0"})
+	defer p.Close()
+
+	s, err := p.Acquire("fake:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := s.Handle()
+	p.Release(s)
+
+	f.mu.Lock()
+	f.controlErr = IoError
+	f.mu.Unlock()
+	s2, err := p.Acquire("fake:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s2 == s || f.isOpen(h) || !f.isOpen(s2.Handle()) {
+		t.Error("Scanner failing its health check not reopened")
+	}
+}
+
+// staleFake is a fakeBackend counting the options controlled on handles
+// that are not open.
+type staleFake struct {
+	*fakeBackend
+	stale *int
+}
+
+func (f staleFake) ControlOption(h SHandle, n SInt, a Action, v interface{}) (Info, error) {
+	if !f.isOpen(h) {
+		f.mu.Lock()
+		*f.stale++
+		f.mu.Unlock()
+	}
+	return f.fakeBackend.ControlOption(h, n, a, v)
+}
+
+func TestPoolReopenAfterCloseOnError(t *testing.T) {
+	f := staleFake{newFakeBackend(), new(int)}
+	SetBackend(f)
+	Init(0, nil)
+	defer Exit()
+	p := NewPool([]string{"fake:0"})
+	defer p.Close()
+
+	s, err := p.Acquire("fake:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.CloseOnError = true
+	h := s.Handle()
+	f.mu.Lock()
+	f.failRead = IoError
+	f.mu.Unlock()
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Read(make([]byte, 8)); !errors.Is(err, IoError) || !s.NeedsReopen() {
+		t.Fatalf("Read = %v, want IoError closing the Scanner", err)
+	}
+	p.Release(s)
+
+	f.mu.Lock()
+	f.failRead = nil
+	f.mu.Unlock()
+	s2, err := p.Acquire("fake:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s2.NeedsReopen() || f.isOpen(h) || !f.isOpen(s2.Handle()) {
+		t.Error("Scanner closed on error not reopened")
+	}
+	if *f.stale != 0 {
+		t.Errorf("%d options controlled on a closed handle", *f.stale)
+	}
+	if _, err := s2.GetParameters(); err != nil {
+		t.Errorf("GetParameters after Acquire = %v", err)
+	}
+}
+
+func TestPoolOpenUnlocked(t *testing.T) {
+	f := newFakeBackend()
+	SetBackend(f)
+	Init(0, nil)
+	defer Exit()
+	p := NewPool([]string{"a", "b"})
+	defer p.Close()
+
+	// Open a on its own, then hold up the opening of b.
+	a, err := p.Acquire("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Release(a)
+	block, waiting := make(chan struct{}), make(chan struct{})
+	f.mu.Lock()
+	f.openBlock, f.openWaiting = block, waiting
+	f.mu.Unlock()
+	done := make(chan error)
+	go func() {
+		_, err := p.Acquire("b")
+		done <- err
+	}()
+	<-waiting // b is reserved and opening
+
+	acquired := make(chan error)
+	go func() {
+		_, err := p.Acquire("a")
+		acquired <- err
+	}()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Acquire of a waited for b to open")
+	}
+	if _, err := p.Acquire("b"); err != DeviceBusy {
+		t.Errorf("Acquire of b while opening = %v, want DeviceBusy", err)
+	}
+	close(block)
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
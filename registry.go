@@ -0,0 +1,130 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// handleState is what gosane tracks about each open handle.
+type handleState struct {
+	// seq orders handles by the time they were opened.
+	seq uint64
+
+	// started is set between a successful Start and the following Cancel,
+	// and acquireStart holds the time of the first such Start.
+	started      bool
+	acquireStart time.Time
+
+	// stats of the most recent scan, and when it started.
+	stats     ScanStats
+	scanStart time.Time
+
+	// chunkSize is the size of the reads set by SetReadChunkSize, or 0.
+	chunkSize int
+}
+
+var (
+	handlesMu sync.Mutex
+	handles   = make(map[SHandle]*handleState)
+	handleSeq uint64
+)
+
+// registerHandle starts tracking h, which has just been opened.
+func registerHandle(h SHandle) {
+	handlesMu.Lock()
+	defer handlesMu.Unlock()
+	handleSeq++
+	handles[h] = &handleState{seq: handleSeq}
+}
+
+// unregisterHandle stops tracking h, which is being closed.
+func unregisterHandle(h SHandle) {
+	handlesMu.Lock()
+	defer handlesMu.Unlock()
+	delete(handles, h)
+}
+
+// openHandles returns the tracked handles in the order they were opened.
+func openHandles() []SHandle {
+	handlesMu.Lock()
+	defer handlesMu.Unlock()
+	hs := make([]SHandle, 0, len(handles))
+	for h := range handles {
+		hs = append(hs, h)
+	}
+	sort.Slice(hs, func(i, j int) bool {
+		return handles[hs[i]].seq < handles[hs[j]].seq
+	})
+	return hs
+}
+
+// setStarted records whether acquisition on h is in progress. When it
+// stops, the time since it started is returned; ok is false if it was not
+// in progress.
+func setStarted(h SHandle, started bool) (elapsed time.Duration, ok bool) {
+	handlesMu.Lock()
+	defer handlesMu.Unlock()
+	st, tracked := handles[h]
+	if !tracked || st.started == started {
+		return 0, false
+	}
+	st.started = started
+	if started {
+		st.acquireStart = time.Now()
+		return 0, false
+	}
+	return time.Since(st.acquireStart), true
+}
+
+// notStarted reports whether h is known not to have been started. Handles
+// gosane does not track are assumed to be started.
+func notStarted(h SHandle) bool {
+	handlesMu.Lock()
+	defer handlesMu.Unlock()
+	st, ok := handles[h]
+	return ok && !st.started
+}
+
+// acquiring reports whether h is known to have been started.
+func acquiring(h SHandle) bool {
+	handlesMu.Lock()
+	defer handlesMu.Unlock()
+	st, ok := handles[h]
+	return ok && st.started
+}
+
+// IsStarted reports whether acquisition on h is in progress, i.e. Start has
+// succeeded and Cancel has not been called since. Until then, GetParameters
+// only returns an estimate of the parameters. Handles not obtained from Open
+// are always reported as started.
+func IsStarted(h SHandle) bool {
+	return !notStarted(h)
+}
+
+// setChunkSize records the read size of h. It reports false if h is not
+// tracked.
+func setChunkSize(h SHandle, n int) bool {
+	handlesMu.Lock()
+	defer handlesMu.Unlock()
+	st, ok := handles[h]
+	if ok {
+		st.chunkSize = n
+	}
+	return ok
+}
+
+// chunkSize returns the read size set for h with SetReadChunkSize, or def if
+// none was set.
+func chunkSize(h SHandle, def int) int {
+	handlesMu.Lock()
+	defer handlesMu.Unlock()
+	if st, ok := handles[h]; ok && st.chunkSize > 0 {
+		return st.chunkSize
+	}
+	return def
+}
@@ -0,0 +1,127 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Resolutions returns the resolutions, in DPI, supported by h. If the
+// resolution is constrained by a word or string list, the values are
+// returned in increasing order and isRange is false, so a UI can offer a
+// drop-down. If it is constrained by a range, values holds its minimum,
+// maximum and step (0 if any value is allowed) and isRange is true, so a UI
+// can offer a slider. Unsupported is returned if the device has no
+// resolution option or the option is not constrained.
+func Resolutions(h SHandle) (values []float64, isRange bool, err error) {
+	_, d, err := FindOption(h, NameScanResolution)
+	if err != nil {
+		return nil, false, err
+	}
+	switch c := d.Constraint.(type) {
+	case RangeConstraint:
+		min, max, quant, _ := d.RangeInfo()
+		return []float64{min, max, quant}, true, nil
+	case WordListConstraint:
+		for _, w := range c {
+			values = append(values, wordToFloat(d.Type, w))
+		}
+	case StringListConstraint:
+		for _, s := range c {
+			v, err := strconv.ParseFloat(strings.TrimSpace(string(s)), 64)
+			if err != nil {
+				return nil, false, typeMismatch(NameScanResolution)
+			}
+			values = append(values, v)
+		}
+	default:
+		return nil, false, Unsupported
+	}
+	sort.Float64s(values)
+	return values, false, nil
+}
+
+// hasActiveOption reports whether h has an active option named name.
+func hasActiveOption(h SHandle, name SStringConst) (bool, error) {
+	_, d, err := FindOption(h, name)
+	if err == Unsupported {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return d.Cap&Inactive == 0, nil
+}
+
+// SetResolutionXY sets the horizontal and vertical resolution of h, in DPI.
+// For devices with separate y-resolution (and possibly x-resolution)
+// options, the resolution-bind option, if any, is turned off when x and y
+// differ and on when they are equal. Devices with a single resolution
+// option only accept equal values; Unsupported is returned otherwise.
+func SetResolutionXY(h SHandle, x, y float64) error {
+	_, _, err := FindOption(h, NameScanYRes)
+	if err == Unsupported {
+		if x != y {
+			return Unsupported
+		}
+		_, _, err := setFloatOption(h, NameScanResolution, x)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	bind, err := hasActiveOption(h, NameResolutionBind)
+	if err != nil {
+		return err
+	}
+	if bind {
+		if _, err := setBoolOption(h, NameResolutionBind, x == y); err != nil {
+			return err
+		}
+		if x == y {
+			_, _, err := setFloatOption(h, NameScanResolution, x)
+			return err
+		}
+	}
+	xname := NameScanResolution
+	if ok, err := hasActiveOption(h, NameScanXRes); err != nil {
+		return err
+	} else if ok {
+		xname = NameScanXRes
+	}
+	if _, _, err := setFloatOption(h, xname, x); err != nil {
+		return err
+	}
+	_, _, err = setFloatOption(h, NameScanYRes, y)
+	return err
+}
+
+// GetResolutionXY returns the horizontal and vertical resolution of h, in
+// DPI. For devices with a single resolution option, or whose y-resolution
+// option is inactive because the resolutions are bound, both are the same.
+func GetResolutionXY(h SHandle) (x, y float64, err error) {
+	separate, err := hasActiveOption(h, NameScanYRes)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !separate {
+		x, _, err = getFloatOption(h, NameScanResolution)
+		return x, x, err
+	}
+	xname := NameScanResolution
+	if ok, err := hasActiveOption(h, NameScanXRes); err != nil {
+		return 0, 0, err
+	} else if ok {
+		xname = NameScanXRes
+	}
+	if x, _, err = getFloatOption(h, xname); err != nil {
+		return 0, 0, err
+	}
+	y, _, err = getFloatOption(h, NameScanYRes)
+	return x, y, err
+}
@@ -0,0 +1,108 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolutions(t *testing.T) {
+	f := newFakeBackend()
+	res := f.option(NameScanResolution)
+	h := setupFake(t, f)
+	defer Exit()
+
+	for _, c := range []struct {
+		name    string
+		typ     ValueType
+		c       Constraint
+		want    []float64
+		isRange bool
+	}{
+		{"word list", TypeInt, WordListConstraint{600, 75, 300, 150}, []float64{75, 150, 300, 600}, false},
+		{"fixed word list", TypeFixed, WordListConstraint{SWord(FloatToFixed(150)), SWord(FloatToFixed(75.5))}, []float64{75.5, 150}, false},
+		{"string list", TypeString, StringListConstraint{"300", " 100", "1200"}, []float64{100, 300, 1200}, false},
+		{"range", TypeInt, RangeConstraint{SRange{Min: 50, Max: 1200, Quant: 10}}, []float64{50, 1200, 10}, true},
+		{"continuous range", TypeFixed, RangeConstraint{SRange{Min: SWord(FloatToFixed(25)), Max: SWord(FloatToFixed(600))}}, []float64{25, 600, 0}, true},
+	} {
+		res.desc.Type, res.desc.Constraint = c.typ, c.c
+		values, isRange, err := Resolutions(h)
+		if err != nil || isRange != c.isRange || !reflect.DeepEqual(values, c.want) {
+			t.Errorf("%s: Resolutions = %v, %v, %v; want %v, %v", c.name, values, isRange, err, c.want, c.isRange)
+		}
+	}
+
+	res.desc.Type, res.desc.Constraint = TypeString, StringListConstraint{"Auto", "300"}
+	if _, _, err := Resolutions(h); err == nil {
+		t.Error("non-numeric resolution accepted")
+	}
+	res.desc.Type, res.desc.Constraint = TypeInt, nil
+	if _, _, err := Resolutions(h); err != Unsupported {
+		t.Errorf("unconstrained resolution: %v, want Unsupported", err)
+	}
+}
+
+// bindFake returns a fakeBackend with a resolution-bind option, which
+// deactivates the y-resolution option while on, as SANE backends do.
+func bindFake() *fakeBackend {
+	f := newFakeBackend()
+	bind := f.addOption(OptionDescriptor{Name: NameResolutionBind, Type: TypeBool, Size: 4, Cap: SoftSelect | SoftDetect}, STRUE)
+	f.addOption(OptionDescriptor{Name: NameScanYRes, Type: TypeInt, Unit: UnitDpi, Size: 4, Cap: SoftSelect | SoftDetect | Inactive,
+		Constraint: WordListConstraint{75, 150, 300}}, 300)
+	f.onSet = func(n SInt) Info {
+		if n != bind {
+			return 0
+		}
+		if y := f.option(NameScanYRes); f.opts[bind].words[0] != SFALSE {
+			y.desc.Cap |= Inactive
+		} else {
+			y.desc.Cap &^= Inactive
+		}
+		return ReloadOptions
+	}
+	return f
+}
+
+func TestSetResolutionXY(t *testing.T) {
+	f := bindFake()
+	h := setupFake(t, f)
+	word := func(name SStringConst) SWord { return f.option(name).words[0] }
+
+	if err := SetResolutionXY(h, 300, 150); err != nil {
+		t.Fatal(err)
+	}
+	if word(NameResolutionBind) != SFALSE || word(NameScanResolution) != 300 || word(NameScanYRes) != 150 {
+		t.Errorf("unbound: bind %d, x %d, y %d; want 0, 300, 150", word(NameResolutionBind), word(NameScanResolution), word(NameScanYRes))
+	}
+	if x, y, err := GetResolutionXY(h); x != 300 || y != 150 || err != nil {
+		t.Errorf("GetResolutionXY unbound = %v, %v, %v; want 300, 150", x, y, err)
+	}
+
+	if err := SetResolutionXY(h, 75, 75); err != nil {
+		t.Fatal(err)
+	}
+	if word(NameResolutionBind) != STRUE || word(NameScanResolution) != 75 {
+		t.Errorf("bound: bind %d, resolution %d; want 1, 75", word(NameResolutionBind), word(NameScanResolution))
+	}
+	if x, y, err := GetResolutionXY(h); x != 75 || y != 75 || err != nil {
+		t.Errorf("GetResolutionXY bound = %v, %v, %v; want 75, 75", x, y, err)
+	}
+	Exit()
+
+	// A device with a single resolution option.
+	f = newFakeBackend()
+	h = setupFake(t, f)
+	defer Exit()
+	if err := SetResolutionXY(h, 150, 150); err != nil || word(NameScanResolution) != 150 {
+		t.Errorf("SetResolutionXY(150, 150) = %v, resolution %d", err, word(NameScanResolution))
+	}
+	if err := SetResolutionXY(h, 300, 150); err != Unsupported {
+		t.Errorf("SetResolutionXY(300, 150) = %v, want Unsupported", err)
+	}
+	if x, y, err := GetResolutionXY(h); x != 150 || y != 150 || err != nil {
+		t.Errorf("GetResolutionXY = %v, %v, %v; want 150, 150", x, y, err)
+	}
+}
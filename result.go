@@ -0,0 +1,53 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"image"
+	"io"
+)
+
+// Orientation tells how the rows of an image are ordered.
+type Orientation int
+
+const (
+	// OrientationTopDown means the first row is the top of the scanned
+	// area, which the SANE standard guarantees for all frames.
+	OrientationTopDown Orientation = iota
+)
+
+// Result is a scanned image along with the metadata downstream consumers
+// need to reproduce it at its physical size.
+type Result struct {
+	// Image holds the decoded pixels, as returned by ScanImage.
+	Image image.Image
+
+	// Orientation of the rows of Image.
+	Orientation Orientation
+
+	// XDPI and YDPI are the horizontal and vertical resolution of Image,
+	// or 0 if the device has no resolution option.
+	XDPI, YDPI float64
+}
+
+// ScanResult is like ScanImage, but also records the resolution of the
+// image, as set by the resolution options of h when the scan starts.
+func ScanResult(h SHandle) (*Result, error) {
+	x, y, err := GetResolutionXY(h)
+	if err != nil && err != Unsupported {
+		return nil, err
+	}
+	img, err := ScanImage(h)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Image: img, Orientation: OrientationTopDown, XDPI: x, YDPI: y}, nil
+}
+
+// WritePNG writes the image of r to w as by WritePNG, also recording its
+// resolution in a pHYs chunk when it is known.
+func (r *Result) WritePNG(w io.Writer) error {
+	return writePNG(w, r.Image, r.XDPI, r.YDPI)
+}
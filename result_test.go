@@ -0,0 +1,73 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// pngPHYsChunk returns the pixels per unit and unit of the pHYs chunk of
+// the PNG file data, or ok false if it has none.
+func pngPHYsChunk(t *testing.T, data []byte) (x, y uint32, unit byte, ok bool) {
+	t.Helper()
+	types, bodies := pngChunks(t, data)
+	for i, typ := range types {
+		if typ == "pHYs" {
+			b := bodies[i]
+			if len(b) != 9 {
+				t.Fatalf("pHYs chunk of %d bytes", len(b))
+			}
+			return binary.BigEndian.Uint32(b), binary.BigEndian.Uint32(b[4:]), b[8], true
+		}
+	}
+	return 0, 0, 0, false
+}
+
+func TestScanResult(t *testing.T) {
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	defer Exit()
+
+	r, err := ScanResult(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.XDPI != 300 || r.YDPI != 300 || r.Orientation != OrientationTopDown {
+		t.Errorf("result at %vx%v dpi, orientation %d; want 300x300, top-down", r.XDPI, r.YDPI, r.Orientation)
+	}
+	var buf bytes.Buffer
+	if err := r.WritePNG(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// 300 dpi is 11811 pixels per meter.
+	if x, y, unit, ok := pngPHYsChunk(t, buf.Bytes()); !ok || x != 11811 || y != 11811 || unit != 1 {
+		t.Errorf("pHYs chunk %d, %d, unit %d (present %v); want 11811, 11811, meter", x, y, unit, ok)
+	}
+
+	buf.Reset()
+	if err := WritePNG(&buf, r.Image); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, ok := pngPHYsChunk(t, buf.Bytes()); ok {
+		t.Error("WritePNG recorded a resolution")
+	}
+
+	// Without a resolution option, the resolution is unknown and not
+	// recorded.
+	f.opts = append(f.opts[:1], f.opts[2:]...)
+	f.opts[0].words[0]--
+	if r, err = ScanResult(h); err != nil || r.XDPI != 0 || r.YDPI != 0 {
+		t.Errorf("ScanResult without resolution = %+v, %v", r, err)
+	}
+	buf.Reset()
+	if err := r.WritePNG(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, ok := pngPHYsChunk(t, buf.Bytes()); ok {
+		t.Error("pHYs chunk written for an unknown resolution")
+	}
+}
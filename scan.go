@@ -0,0 +1,522 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// ScanImage acquires a single frame image from h and returns it decoded.
+// FrameGray images are returned as *image.Gray (depth 1 and 8) or
+// *image.Gray16 (depth 9 to 16), and FrameRGB images as *image.RGBA (depth
+// 8) or *image.RGBA64 (depth 9 to 16), keeping the full precision. Depths
+// between 9 and 15 are decoded as set by SetSampleJustify. If the device's
+// compression mode is JPEG, the data read is a JPEG stream and is decoded
+// as such. ErrEmptyFrame is returned if the frame holds no data.
+func ScanImage(h SHandle) (image.Image, error) {
+	return scanImage(context.Background(), h, false, readFrame)
+}
+
+// ScanImageContext is like ScanImage, but the scan is cancelled when ctx is
+// done, in which case ctx.Err() is returned.
+func ScanImageContext(ctx context.Context, h SHandle) (image.Image, error) {
+	return scanImage(ctx, h, false, readFrame)
+}
+
+// ScanImageTimeout is like ScanImage, but gives up if the whole scan, from
+// Start until the end of the frame, takes longer than d: the scan is
+// cancelled and ErrTimeout is returned. h is left ready for another scan.
+func ScanImageTimeout(h SHandle, d time.Duration) (image.Image, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	// Cover Start as well, which setupIOMode does not. As there, wait for
+	// the watchdog to exit so that it cannot cancel a later scan.
+	done, exited := make(chan struct{}), make(chan struct{})
+	defer func() {
+		close(done)
+		<-exited
+	}()
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			Cancel(h)
+		case <-done:
+		}
+	}()
+
+	img, err := scanImage(ctx, h, false, readFrame)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return nil, ErrTimeout
+	}
+	return img, err
+}
+
+// readyInterval is how long WaitReady waits between attempts to start a busy
+// device.
+const readyInterval = 100 * time.Millisecond
+
+// WaitReady waits for h to become ready to scan, e.g. after power-on or
+// while its lamp warms up, during which Start fails with DeviceBusy. It
+// calls Start, cancelling the scan right away if it succeeds, until it
+// does not fail with DeviceBusy or timeout has elapsed, in which case
+// DeviceBusy is returned. Other errors from Start are returned immediately.
+func WaitReady(h SHandle, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := Start(h)
+		if err == nil {
+			Cancel(h)
+			return nil
+		}
+		if err != DeviceBusy {
+			return err
+		}
+		left := time.Until(deadline)
+		if left <= 0 {
+			return err
+		}
+		if left > readyInterval {
+			left = readyInterval
+		}
+		time.Sleep(left)
+	}
+}
+
+// ScanColorImage is like ScanImage, but also handles devices that acquire
+// a color image in three passes, one frame per channel (FrameRed,
+// FrameGreen and FrameBlue), which are combined into an *image.RGBA. Frames
+// are acquired until one has LastFrame set. Backends usually send the red,
+// green and blue frames in that order, but each frame is placed according
+// to its format so the order does not matter; all three must be present
+// and have the same dimensions. Single frame images are returned as by
+// ScanImage.
+//
+// The parameters are read again for every frame; if a frame's geometry
+// differs from that of the first, a *FrameMismatch is returned rather than
+// a garbled image.
+func ScanColorImage(h SHandle) (image.Image, error) {
+	beginScanStats(h)
+	defer Cancel(h)
+
+	var planes [3]*image.Gray
+	var first *Parameters
+	for frame := 0; ; frame++ {
+		if err := Start(h); err != nil {
+			return nil, err
+		}
+		p, err := GetParameters(h)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+		if first == nil {
+			first = p
+		} else if err := checkFrameGeometry(frame, first, p); err != nil {
+			return nil, err
+		}
+		data, err := readFrame(context.Background(), h, p)
+		if err != nil {
+			return nil, err
+		}
+		if p.Format == FrameGray || p.Format == FrameRGB {
+			if frame > 0 {
+				return nil, &FrameMismatch{Frame: frame, Field: "Format", Want: SInt(first.Format), Got: SInt(p.Format)}
+			}
+			return decodeFrame(p, data)
+		}
+		plane, err := decodeChannelFrame(p, data, p.Format)
+		if err != nil {
+			return nil, err
+		}
+		planes[p.Format-FrameRed] = plane
+		if p.IsLastFrame() {
+			break
+		}
+	}
+
+	for _, plane := range planes {
+		if plane == nil || plane.Rect != planes[0].Rect {
+			return nil, Inval
+		}
+	}
+	img := image.NewRGBA(planes[0].Rect)
+	for i := 0; i < len(img.Pix)/4; i++ {
+		img.Pix[4*i] = planes[0].Pix[i]
+		img.Pix[4*i+1] = planes[1].Pix[i]
+		img.Pix[4*i+2] = planes[2].Pix[i]
+		img.Pix[4*i+3] = 0xff
+	}
+	return img, nil
+}
+
+// checkFrameGeometry returns a *FrameMismatch if the parameters p of frame
+// do not have the same geometry as those of the first frame. The number of
+// lines is only compared when both are known.
+func checkFrameGeometry(frame int, first, p *Parameters) error {
+	fields := []struct {
+		name      string
+		want, got SInt
+	}{
+		{"BytesPerLine", first.BytesPerLine, p.BytesPerLine},
+		{"PixelsPerLine", first.PixelsPerLine, p.PixelsPerLine},
+		{"Depth", first.Depth, p.Depth},
+		{"Lines", first.Lines, p.Lines},
+	}
+	for _, f := range fields {
+		if f.name == "Lines" && (f.want < 0 || f.got < 0) {
+			continue
+		}
+		if f.want != f.got {
+			return &FrameMismatch{Frame: frame, Field: f.name, Want: f.want, Got: f.got}
+		}
+	}
+	return nil
+}
+
+// CompressionMode returns the value of the compression option of h, e.g.
+// "None" or "JPEG". "None" is returned for devices without the option.
+func CompressionMode(h SHandle) (string, error) {
+	mode, err := getStringOption(h, NameCompression)
+	if err == Unsupported {
+		return "None", nil
+	}
+	return mode, err
+}
+
+// ScanImagePartial is like ScanImage, except that if reading fails part way
+// through the frame the lines read so far are returned along with the error.
+// The bytes of lines that could not be read are left zero-filled. If the number
+// of lines was not known in advance, only the complete lines read so far are
+// returned.
+func ScanImagePartial(h SHandle) (image.Image, error) {
+	return scanImage(context.Background(), h, true, readFrame)
+}
+
+// scanImage implements the ScanImage functions, reading the frame with
+// read, which is readFrame or readFrameFast.
+func scanImage(ctx context.Context, h SHandle, partial bool, read func(context.Context, SHandle, *Parameters) ([]byte, error)) (image.Image, error) {
+	mode, err := CompressionMode(h)
+	if err != nil {
+		return nil, err
+	}
+	compressed := strings.EqualFold(mode, "JPEG")
+
+	beginScanStats(h)
+	if err := Start(h); err != nil {
+		return nil, err
+	}
+	defer Cancel(h)
+
+	p, err := GetParameters(h)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	stop := setupIOMode(ctx, h)
+	defer stop()
+	data, readErr := read(ctx, h, p)
+	if compressed {
+		if readErr != nil {
+			return nil, readErr
+		}
+		if len(data) == 0 {
+			return nil, ErrEmptyFrame
+		}
+		return jpeg.Decode(bytes.NewReader(data))
+	}
+	if readErr != nil {
+		if !partial {
+			return nil, readErr
+		}
+		if size := frameSize(p); size > len(data) {
+			data = append(data, make([]byte, size-len(data))...)
+		} else if size < 0 && p.BytesPerLine > 0 {
+			data = data[:len(data)-len(data)%int(p.BytesPerLine)]
+		}
+	}
+	img, err := decodeFrame(p, data)
+	if err == ErrEmptyFrame && readErr != nil {
+		return nil, readErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return img, readErr
+}
+
+// discardScan acquires all frames of an image from h and throws them away.
+func discardScan(h SHandle) error {
+	defer Cancel(h)
+	for {
+		if err := Start(h); err != nil {
+			return err
+		}
+		p, err := GetParameters(h)
+		if err != nil {
+			return err
+		}
+		if _, err := readFrame(context.Background(), h, p); err != nil {
+			return err
+		}
+		if p.IsLastFrame() {
+			return nil
+		}
+	}
+}
+
+// Calibrate prepares h for scanning. If the device has an active calibrate
+// button option it is pressed; otherwise a preview scan is performed and
+// discarded, which warms up the lamp of most flatbed scanners.
+func Calibrate(h SHandle) error {
+	n, d, err := FindOption(h, NameCalibrate)
+	if err == nil && d.Type == TypeButton && d.Cap&Inactive == 0 {
+		_, err = ControlOption(h, n, ActionSetValue, nil)
+		return err
+	}
+
+	preview, err := getBoolOption(h, NamePreview)
+	if err != nil || preview {
+		return discardScan(h)
+	}
+	if _, err := setBoolOption(h, NamePreview, true); err != nil {
+		return err
+	}
+	// Failing to turn preview off again would leave the next scan at
+	// preview quality, so it is reported as well.
+	err = discardScan(h)
+	if _, rerr := setBoolOption(h, NamePreview, false); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// previewResolution is the resolution, in DPI, PreviewArea scans at.
+const previewResolution = 75
+
+// nearestResolution returns the resolution supported by h closest to dpi.
+func nearestResolution(h SHandle, dpi float64) (float64, error) {
+	values, isRange, err := Resolutions(h)
+	if err != nil {
+		return 0, err
+	}
+	if isRange {
+		return math.Max(values[0], math.Min(values[1], dpi)), nil
+	}
+	best := values[0]
+	for _, v := range values[1:] {
+		if math.Abs(v-dpi) < math.Abs(best-dpi) {
+			best = v
+		}
+	}
+	return best, nil
+}
+
+// PreviewArea quickly scans the area of h from tlx, tly to brx, bry (in mm)
+// at a low resolution, e.g. to refresh the preview of a selection in a GUI.
+// The preview option is turned on for the scan if the device has one. All
+// options touched, including the scan area and resolution, are restored
+// afterwards.
+func PreviewArea(h SHandle, tlx, tly, brx, bry float64) (img image.Image, err error) {
+	state, err := Snapshot(h)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if rerr := Restore(h, state); err == nil {
+			err = rerr
+		}
+	}()
+
+	if _, _, err := FindOption(h, NamePreview); err == nil {
+		if _, err := setBoolOption(h, NamePreview, true); err != nil {
+			return nil, err
+		}
+	}
+	dpi, err := nearestResolution(h, previewResolution)
+	if err != nil && err != Unsupported {
+		return nil, err
+	}
+	if err == nil {
+		if _, _, err := setFloatOption(h, NameScanResolution, dpi); err != nil {
+			return nil, err
+		}
+	}
+	if _, _, _, _, err := setScanArea(h, tlx, tly, brx, bry); err != nil {
+		return nil, err
+	}
+	return ScanImage(h)
+}
+
+// ScanInto acquires a single 8-bit RGB frame from h into dst, reusing its
+// pixel buffer instead of allocating a new image, e.g. when a batch scanner
+// scans many pages of the same size. The bounds of dst must match the
+// dimensions of the frame as reported by GetParameters once the scan has
+// started; a LibError is returned otherwise, and for devices that do not
+// know the number of lines in advance.
+func ScanInto(h SHandle, dst *image.RGBA) error {
+	return scanInto(h, dst.Rect, func(p *Parameters) bool {
+		return p.Format == FrameRGB && p.Depth == 8
+	}, func(y int, line []byte) {
+		pix := dst.Pix[y*dst.Stride:]
+		for x := 0; x < dst.Rect.Dx(); x++ {
+			copy(pix[4*x:4*x+3], line[3*x:3*x+3])
+			pix[4*x+3] = 0xff
+		}
+	})
+}
+
+// ScanIntoGray is like ScanInto, for a gray frame of depth 1 or 8.
+func ScanIntoGray(h SHandle, dst *image.Gray) error {
+	var depth SInt
+	return scanInto(h, dst.Rect, func(p *Parameters) bool {
+		depth = p.Depth
+		return p.Format == FrameGray && (p.Depth == 1 || p.Depth == 8)
+	}, func(y int, line []byte) {
+		pix := dst.Pix[y*dst.Stride : y*dst.Stride+dst.Rect.Dx()]
+		if depth == 8 {
+			copy(pix, line)
+			return
+		}
+		for x := range pix {
+			pix[x] = 0
+			if line[x/8]&(0x80>>uint(x%8)) == 0 {
+				pix[x] = 0xff
+			}
+		}
+	})
+}
+
+// ScanIntoGray16 is like ScanInto, for a gray frame of depth 9 to 16.
+func ScanIntoGray16(h SHandle, dst *image.Gray16) error {
+	var sample func([]byte) uint16
+	return scanInto(h, dst.Rect, func(p *Parameters) bool {
+		sample = sampleScaler(p.Depth)
+		return p.Format == FrameGray && sampleBits(p.Depth) == 16
+	}, func(y int, line []byte) {
+		pix := dst.Pix[y*dst.Stride:]
+		for x := 0; x < dst.Rect.Dx(); x++ {
+			binary.BigEndian.PutUint16(pix[2*x:], sample(line[2*x:]))
+		}
+	})
+}
+
+// scanInto implements the ScanInto functions: it starts h, checks that the
+// frame matches bounds and accepts it, and passes each line read to store
+// along with its index.
+func scanInto(h SHandle, bounds image.Rectangle, accept func(*Parameters) bool, store func(y int, line []byte)) error {
+	beginScanStats(h)
+	if err := Start(h); err != nil {
+		return err
+	}
+	defer Cancel(h)
+
+	p, err := GetParameters(h)
+	if err != nil {
+		return err
+	}
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if !accept(p) {
+		return &LibError{Op: "ScanInto", Err: fmt.Errorf("image type does not match frame format %d of depth %d", p.Format, p.Depth)}
+	}
+	if bounds.Dx() != int(p.PixelsPerLine) || bounds.Dy() != int(p.Lines) {
+		return &LibError{Op: "ScanInto", Err: fmt.Errorf("image is %dx%d, frame is %dx%d", bounds.Dx(), bounds.Dy(), p.PixelsPerLine, p.Lines)}
+	}
+
+	line := make([]byte, p.BytesPerLine)
+	buf := make([]byte, chunkSize(h, readChunkSize))
+	for y, off := 0, 0; y < int(p.Lines); {
+		n, err := Read(h, buf)
+		addReadStats(h, n)
+		for data := buf[:n]; len(data) > 0 && y < int(p.Lines); {
+			m := copy(line[off:], data)
+			data, off = data[m:], off+m
+			if off == len(line) {
+				store(y, line)
+				y, off = y+1, 0
+			}
+		}
+		if err == Eof && y < int(p.Lines) {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil && err != Eof {
+			return err
+		}
+	}
+	return nil
+}
+
+// fastReadSize is the approximate size of the reads issued by ScanImageFast.
+const fastReadSize = 1 << 20
+
+// ScanImageFast is like ScanImage, but reads straight into the frame buffer
+// in large chunks that are a multiple of the line size, unless a size was
+// set with SetReadChunkSize, instead of copying through a small
+// intermediate buffer. It is meant for high-throughput document capture.
+// The image returned is identical to that of ScanImage.
+func ScanImageFast(h SHandle) (image.Image, error) {
+	return scanImage(context.Background(), h, false, readFrameFast)
+}
+
+// readFrameFast is like readFrame, but reads into a buffer of the size of
+// the frame as described by p, if known, in chunks of about fastReadSize.
+// Data the backend returns beyond that size is kept, as it is for
+// compressed frames.
+func readFrameFast(ctx context.Context, h SHandle, p *Parameters) ([]byte, error) {
+	size := frameSize(p)
+	if size <= 0 {
+		return readFrame(ctx, h, p)
+	}
+	bpl := int(p.BytesPerLine)
+	chunk := chunkSize(h, fastReadSize/bpl*bpl)
+	if chunk == 0 {
+		chunk = bpl
+	}
+	data := make([]byte, size)
+	for off := 0; off < size; {
+		end := off + chunk
+		if end > size {
+			end = size
+		}
+		n, err := Read(h, data[off:end])
+		addReadStats(h, n)
+		off += n
+		if err == Eof {
+			return data[:off], nil
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return data[:off], ctx.Err()
+			}
+			return data[:off], err
+		}
+		if n == 0 {
+			select {
+			case <-ctx.Done():
+				return data[:off], ctx.Err()
+			case <-time.After(pollInterval):
+			}
+		}
+	}
+	// The buffer is full, but the backend has yet to report Eof.
+	rest, err := readFrame(ctx, h, &Parameters{Lines: -1})
+	return append(data, rest...), err
+}
@@ -0,0 +1,434 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fastFrames are frames ScanImageFast must decode as ScanImage does.
+var fastFrames = []struct {
+	name   string
+	params Parameters
+	size   int
+}{
+	{"gray", Parameters{Format: FrameGray, BytesPerLine: 13, PixelsPerLine: 11, Lines: 7, Depth: 8}, 13 * 7},
+	{"lineart", Parameters{Format: FrameGray, BytesPerLine: 2, PixelsPerLine: 12, Lines: 5, Depth: 1}, 2 * 5},
+	{"rgb", Parameters{Format: FrameRGB, BytesPerLine: 30, PixelsPerLine: 10, Lines: 6, Depth: 8}, 30 * 6},
+	{"rgb16", Parameters{Format: FrameRGB, BytesPerLine: 24, PixelsPerLine: 4, Lines: 3, Depth: 16}, 24 * 3},
+	{"unknown lines", Parameters{Format: FrameGray, BytesPerLine: 8, PixelsPerLine: 8, Lines: -1, Depth: 8}, 8 * 9},
+}
+
+func TestScanImageFastIdentity(t *testing.T) {
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	defer Exit()
+	for _, c := range fastFrames {
+		for _, chunk := range []int{1, 5, 1 << 20} {
+			f.params = c.params
+			f.params.LastFrame = STRUE
+			f.data = make([]byte, c.size)
+			for i := range f.data {
+				f.data[i] = byte(i * 7)
+			}
+			f.chunk = chunk
+			want, err := ScanImage(h)
+			if err != nil {
+				t.Fatalf("%s: ScanImage: %v", c.name, err)
+			}
+			got, err := ScanImageFast(h)
+			if err != nil {
+				t.Fatalf("%s: ScanImageFast: %v", c.name, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s, chunk %d: ScanImageFast and ScanImage differ", c.name, chunk)
+			}
+		}
+	}
+}
+
+func TestScanImageFastJPEG(t *testing.T) {
+	f := newFakeBackend()
+	f.addOption(OptionDescriptor{Name: NameCompression, Type: TypeString, Size: 8, Cap: SoftSelect | SoftDetect,
+		Constraint: StringListConstraint{"None", "JPEG"}}, "JPEG")
+	h := setupFake(t, f)
+	defer Exit()
+
+	src := image.NewGray(image.Rect(0, 0, 16, 16))
+	for i := range src.Pix {
+		src.Pix[i] = byte(i)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	f.params = Parameters{Format: FrameGray, LastFrame: STRUE, BytesPerLine: 16, PixelsPerLine: 16, Lines: 16, Depth: 8}
+	f.data = buf.Bytes()
+	f.chunk = 100
+
+	want, err := ScanImage(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ScanImageFast(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("ScanImageFast decoded the JPEG stream differently")
+	}
+}
+
+// benchmarkDuplex scans both sides of simulated 300 dpi A4 gray sheets with
+// scan, and reports the pages scanned per second.
+func benchmarkDuplex(b *testing.B, scan func(SHandle) (image.Image, error)) {
+	f := newFakeBackend()
+	SetBackend(f)
+	Init(0, nil)
+	defer Exit()
+	h, _ := Open("fake:0")
+	f.params = Parameters{Format: FrameGray, LastFrame: STRUE, BytesPerLine: 2480, PixelsPerLine: 2480, Lines: 3508, Depth: 8}
+	f.data = make([]byte, 2480*3508)
+	// A backend filling reads of up to 1 MiB at once.
+	f.chunk = 1 << 20
+	b.SetBytes(int64(2 * len(f.data)))
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		for side := 0; side < 2; side++ {
+			if _, err := scan(h); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.ReportMetric(float64(2*b.N)/time.Since(start).Seconds(), "pages/s")
+}
+
+func BenchmarkScanImageDuplex(b *testing.B) {
+	benchmarkDuplex(b, ScanImage)
+}
+
+func BenchmarkScanImageFastDuplex(b *testing.B) {
+	benchmarkDuplex(b, ScanImageFast)
+}
+
+func TestScanIntoChunkSize(t *testing.T) {
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	defer Exit()
+	for _, chunk := range []int{3, 4, 1 << 10} {
+		if err := SetReadChunkSize(h, chunk); err != nil {
+			t.Fatal(err)
+		}
+		f.mu.Lock()
+		f.reads = nil
+		f.mu.Unlock()
+		dst := image.NewGray(image.Rect(0, 0, 4, 2))
+		if err := ScanIntoGray(h, dst); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(dst.Pix, f.data) {
+			t.Errorf("chunk %d: scanned %v, want %v", chunk, dst.Pix, f.data)
+		}
+		for _, n := range f.reads {
+			if n != chunk {
+				t.Errorf("chunk %d: Read of %d bytes", chunk, n)
+			}
+		}
+	}
+}
+
+func TestScanImagePartial(t *testing.T) {
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	defer Exit()
+	// The device fails after sending half of the lines.
+	f.params = Parameters{Format: FrameGray, LastFrame: STRUE, BytesPerLine: 4, PixelsPerLine: 4, Lines: 4, Depth: 8}
+	f.data = []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	f.readErr = IoError
+
+	img, err := ScanImagePartial(h)
+	if err != IoError {
+		t.Fatalf("ScanImagePartial error %v, want IoError", err)
+	}
+	g, ok := img.(*image.Gray)
+	if !ok || g.Bounds() != image.Rect(0, 0, 4, 4) {
+		t.Fatalf("ScanImagePartial returned %T %v, want a 4x4 gray image", img, img.Bounds())
+	}
+	if want := append(append([]byte(nil), f.data...), make([]byte, 8)...); !bytes.Equal(g.Pix, want) {
+		t.Errorf("partial image %v, want %v", g.Pix, want)
+	}
+	if img, err := ScanImage(h); img != nil || err != IoError {
+		t.Errorf("ScanImage = %v, %v; want no image and IoError", img, err)
+	}
+
+	// Without a known line count, only the complete lines are returned.
+	f.params.Lines = -1
+	f.data = f.data[:6]
+	img, err = ScanImagePartial(h)
+	if err != IoError || img == nil || img.Bounds() != image.Rect(0, 0, 4, 1) {
+		t.Errorf("ScanImagePartial of unknown length = %v, %v; want one line and IoError", img, err)
+	}
+}
+
+func TestCalibrateButton(t *testing.T) {
+	f := newFakeBackend()
+	button := f.addOption(OptionDescriptor{Name: NameCalibrate, Type: TypeButton, Cap: SoftSelect}, nil)
+	presses := 0
+	f.onSet = func(n SInt) Info {
+		if n == button {
+			presses++
+		}
+		return 0
+	}
+	h := setupFake(t, f)
+	defer Exit()
+
+	if err := Calibrate(h); err != nil {
+		t.Fatal(err)
+	}
+	if presses != 1 || countCalls(f, "Start") != 0 {
+		t.Errorf("Calibrate pressed the button %d times and scanned %d times, want 1 and 0", presses, countCalls(f, "Start"))
+	}
+}
+
+func TestCalibratePreview(t *testing.T) {
+	f := newFakeBackend()
+	f.addOption(OptionDescriptor{Name: NamePreview, Type: TypeBool, Size: 4, Cap: SoftSelect | SoftDetect}, SFALSE)
+	var during SWord
+	f.onStart = func() error {
+		during = f.option(NamePreview).words[0]
+		return nil
+	}
+	h := setupFake(t, f)
+	defer Exit()
+
+	if err := Calibrate(h); err != nil {
+		t.Fatal(err)
+	}
+	if countCalls(f, "Start") != 1 || during != STRUE {
+		t.Error("Calibrate did not scan a preview")
+	}
+	if f.option(NamePreview).words[0] != SFALSE {
+		t.Error("Calibrate left the preview option on")
+	}
+
+	// The device fails after the scan, so preview cannot be turned off.
+	f.onStart = func() error {
+		f.controlErr = IoError
+		return nil
+	}
+	if err := Calibrate(h); err != IoError {
+		t.Errorf("Calibrate failing to turn preview off = %v, want IoError", err)
+	}
+}
+
+func TestScanImageJPEG(t *testing.T) {
+	f := newFakeBackend()
+	f.addOption(OptionDescriptor{Name: NameCompression, Type: TypeString, Size: 8, Cap: SoftSelect | SoftDetect,
+		Constraint: StringListConstraint{"None", "JPEG"}}, "JPEG")
+	h := setupFake(t, f)
+	defer Exit()
+
+	src := image.NewRGBA(image.Rect(0, 0, 24, 16))
+	for i := range src.Pix {
+		src.Pix[i] = byte(i)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	// The parameters describe the decoded image, not the JPEG stream.
+	f.params = Parameters{Format: FrameRGB, LastFrame: STRUE, BytesPerLine: 72, PixelsPerLine: 24, Lines: 16, Depth: 8}
+	f.data = buf.Bytes()
+
+	want, err := jpeg.Decode(bytes.NewReader(f.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ScanImage(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("ScanImage did not decode the JPEG payload")
+	}
+
+	f.option(NameCompression).str = "None"
+	f.data = make([]byte, 72*16)
+	if img, err := ScanImage(h); err != nil || img.Bounds() != src.Bounds() {
+		t.Errorf("uncompressed ScanImage = %v, %v", img.Bounds(), err)
+	}
+}
+
+func TestScanImageTimeout(t *testing.T) {
+	f := newFakeBackend()
+	f.chunk = 2
+	// The device stalls after the first chunk.
+	f.block = make(chan struct{})
+	h := setupFake(t, f)
+	defer Exit()
+
+	if img, err := ScanImageTimeout(h, 20*time.Millisecond); img != nil || err != ErrTimeout {
+		t.Fatalf("stalled ScanImageTimeout = %v, %v; want ErrTimeout", img, err)
+	}
+	if countCalls(f, "Cancel") == 0 {
+		t.Error("stalled scan not cancelled")
+	}
+	// The handle can scan again.
+	if img, err := ScanImageTimeout(h, 5*time.Second); err != nil || img.Bounds().Dx() != 4 {
+		t.Errorf("ScanImageTimeout after a timeout = %v, %v", img, err)
+	}
+}
+
+func TestPreviewArea(t *testing.T) {
+	f := newFakeBackend()
+	f.addOption(OptionDescriptor{Name: NamePreview, Type: TypeBool, Size: 4, Cap: SoftSelect | SoftDetect}, SFALSE)
+	word := func(name SStringConst) SWord { return f.option(name).words[0] }
+	var during map[SStringConst]SWord
+	f.onStart = func() error {
+		during = map[SStringConst]SWord{}
+		for _, o := range f.opts[1:] {
+			if len(o.words) > 0 {
+				during[o.desc.Name] = o.words[0]
+			}
+		}
+		return nil
+	}
+	h := setupFake(t, f)
+	defer Exit()
+	before, err := OptionValues(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := PreviewArea(h, 10, 20, 60, 80); err != nil {
+		t.Fatal(err)
+	}
+	if during[NamePreview] != STRUE || during[NameScanResolution] != 75 {
+		t.Errorf("previewed with preview %d at %d dpi, want on at 75", during[NamePreview], during[NameScanResolution])
+	}
+	if x, y := FixedToFloat(SFixed(during[NameScanTLX])), FixedToFloat(SFixed(during[NameScanBRY])); x != 10 || y != 80 {
+		t.Errorf("previewed from x %v to y %v, want 10 and 80", x, y)
+	}
+	if after, _ := OptionValues(h); !reflect.DeepEqual(after, before) {
+		t.Errorf("options after PreviewArea %v, want %v", after, before)
+	}
+
+	// The options are restored when the scan fails too.
+	f.readErr = IoError
+	f.data = f.data[:2]
+	if _, err := PreviewArea(h, 10, 20, 60, 80); err != IoError {
+		t.Errorf("failing PreviewArea = %v, want IoError", err)
+	}
+	if word(NamePreview) != SFALSE || word(NameScanResolution) != 300 || word(NameScanTLX) != 0 {
+		t.Error("options not restored after a failed preview")
+	}
+}
+
+func TestScanIntoReuse(t *testing.T) {
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	defer Exit()
+	f.params = Parameters{Format: FrameRGB, LastFrame: STRUE, BytesPerLine: 9, PixelsPerLine: 3, Lines: 2, Depth: 8}
+	f.chunk = 4
+	dst := image.NewRGBA(image.Rect(0, 0, 3, 2))
+
+	var pages []*image.RGBA
+	for page := 0; page < 2; page++ {
+		f.data = make([]byte, 18)
+		for i := range f.data {
+			f.data[i] = byte(page*100 + i)
+		}
+		want, err := ScanImage(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ScanInto(h, dst); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(dst, want) {
+			t.Errorf("page %d: ScanInto gave %v, want %v", page, dst.Pix, want.(*image.RGBA).Pix)
+		}
+		pages = append(pages, &image.RGBA{Pix: append([]byte(nil), dst.Pix...), Stride: dst.Stride, Rect: dst.Rect})
+	}
+	if reflect.DeepEqual(pages[0], pages[1]) {
+		t.Error("second scan did not overwrite the first")
+	}
+
+	var le *LibError
+	if err := ScanInto(h, image.NewRGBA(image.Rect(0, 0, 3, 3))); !errors.As(err, &le) {
+		t.Errorf("ScanInto an image of the wrong size = %v, want a LibError", err)
+	}
+	if err := ScanIntoGray(h, image.NewGray(image.Rect(0, 0, 3, 2))); !errors.As(err, &le) {
+		t.Errorf("ScanIntoGray of a color frame = %v, want a LibError", err)
+	}
+	f.data = f.data[:12]
+	if err := ScanInto(h, dst); err != io.ErrUnexpectedEOF {
+		t.Errorf("ScanInto of a short frame = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestWaitReady(t *testing.T) {
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	defer Exit()
+	// The lamp warms up for 250ms.
+	warm := time.Now().Add(250 * time.Millisecond)
+	f.onStart = func() error {
+		if time.Now().Before(warm) {
+			return DeviceBusy
+		}
+		return nil
+	}
+
+	if err := WaitReady(h, 50*time.Millisecond); err != DeviceBusy {
+		t.Errorf("WaitReady during warm-up = %v, want DeviceBusy", err)
+	}
+	if err := WaitReady(h, 5*time.Second); err != nil {
+		t.Fatalf("WaitReady = %v", err)
+	}
+	if time.Now().Before(warm) {
+		t.Error("WaitReady returned before the device was ready")
+	}
+	if IsStarted(h) {
+		t.Error("WaitReady left the handle started")
+	}
+	if n := countCalls(f, "Start"); n < 3 {
+		t.Errorf("Start called %d times, want one per poll", n)
+	}
+
+	f.onStart = func() error { return CoverOpen }
+	start := time.Now()
+	if err := WaitReady(h, 5*time.Second); err != CoverOpen || time.Since(start) > time.Second {
+		t.Errorf("WaitReady = %v after %v, want CoverOpen at once", err, time.Since(start))
+	}
+}
+
+func TestScanImageEmptyFrame(t *testing.T) {
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	defer Exit()
+	// The backend returns Eof on the first Read.
+	f.data = nil
+
+	for _, lines := range []SInt{2, -1} {
+		f.params.Lines = lines
+		img, err := ScanImage(h)
+		if err != ErrEmptyFrame || img != nil {
+			t.Errorf("ScanImage of an empty frame with %d lines = %v, %v; want ErrEmptyFrame", lines, img, err)
+		}
+	}
+	if n := countCalls(f, "Read"); n != 2 {
+		t.Errorf("Read called %d times, want once per scan", n)
+	}
+}
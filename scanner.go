@@ -0,0 +1,212 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// Scanner wraps an open SHandle.
+//
+// A finalizer closes the handle if the Scanner is garbage collected while
+// still open, and a warning is written to the Logger. This is only a safety
+// net; callers should always Close a Scanner explicitly.
+type Scanner struct {
+	// CloseOnError makes operations that fail with IoError or AccessDenied
+	// close the handle, as some backends become unusable after such errors.
+	// Further operations then fail with ErrClosed until Reopen is called.
+	// It is off by default and should be set before the Scanner is used.
+	CloseOnError bool
+
+	mu          sync.Mutex
+	h           SHandle
+	name        SStringConst
+	closed      bool
+	needsReopen bool
+
+	onReload func(Info)
+}
+
+// OpenScanner opens the device named name and wraps the resulting handle.
+func OpenScanner(name SStringConst) (*Scanner, error) {
+	h, err := Open(name)
+	if err != nil {
+		return nil, err
+	}
+	s := &Scanner{h: h, name: name}
+	runtime.SetFinalizer(s, (*Scanner).finalize)
+	return s, nil
+}
+
+// Handle returns the underlying SHandle.
+func (s *Scanner) Handle() SHandle {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.h
+}
+
+// Name returns the device name the Scanner was opened with.
+func (s *Scanner) Name() SStringConst {
+	return s.name
+}
+
+// Close closes the underlying handle. Calling Close more than once is a
+// no-op.
+func (s *Scanner) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	runtime.SetFinalizer(s, nil)
+	Close(s.h)
+	return nil
+}
+
+// Reopen closes the handle, if still open, and opens the device again,
+// e.g. after CloseOnError closed it.
+func (s *Scanner) Reopen() error {
+	s.Close()
+	h, err := Open(s.name)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.h, s.closed, s.needsReopen = h, false, false
+	s.mu.Unlock()
+	runtime.SetFinalizer(s, (*Scanner).finalize)
+	return nil
+}
+
+// NeedsReopen reports whether the handle was closed because of an error
+// under the CloseOnError policy.
+func (s *Scanner) NeedsReopen() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.needsReopen
+}
+
+// checkError applies the CloseOnError policy to err, the result of an
+// operation, and returns it.
+func (s *Scanner) checkError(err error) error {
+	if s.CloseOnError && (errors.Is(err, IoError) || errors.Is(err, AccessDenied)) {
+		s.Close()
+		s.mu.Lock()
+		s.needsReopen = true
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func (s *Scanner) finalize() {
+	if s.closed {
+		return
+	}
+	currentLogger().Printf("gosane: scanner %q was garbage collected without being closed", s.name)
+	s.Close()
+}
+
+// OnReload registers f to be called whenever ControlOption reports that
+// options or parameters must be reloaded. f is called synchronously from the
+// goroutine that called ControlOption. Passing nil removes the callback.
+func (s *Scanner) OnReload(f func(Info)) {
+	s.mu.Lock()
+	s.onReload = f
+	s.mu.Unlock()
+}
+
+// ControlOption gets or sets option n of the scanner. See the package level
+// ControlOption.
+func (s *Scanner) ControlOption(n SInt, a Action, v interface{}) (Info, error) {
+	h, err := s.handle("ControlOption")
+	if err != nil {
+		return 0, err
+	}
+	info, err := ControlOption(h, n, a, v)
+	if err != nil {
+		return info, s.checkError(err)
+	}
+	s.mu.Lock()
+	f := s.onReload
+	s.mu.Unlock()
+	if f != nil && info&(ReloadOptions|ReloadParams) != 0 {
+		f(info)
+	}
+	return info, nil
+}
+
+// GetParameters returns the scan parameters of the scanner. See the package
+// level GetParameters.
+func (s *Scanner) GetParameters() (*Parameters, error) {
+	h, err := s.handle("GetParameters")
+	if err != nil {
+		return nil, err
+	}
+	p, err := GetParameters(h)
+	return p, s.checkError(err)
+}
+
+// Start initiates acquisition of a frame from the scanner. See the package
+// level Start.
+func (s *Scanner) Start() error {
+	h, err := s.handle("Start")
+	if err != nil {
+		return err
+	}
+	return s.checkError(Start(h))
+}
+
+// Read reads image data of the current frame from the scanner. See the
+// package level Read.
+func (s *Scanner) Read(buf []byte) (int, error) {
+	h, err := s.handle("Read")
+	if err != nil {
+		return 0, err
+	}
+	n, err := Read(h, buf)
+	return n, s.checkError(err)
+}
+
+// Cancel cancels the currently pending operation of the scanner. It is a
+// no-op once the scanner is closed.
+func (s *Scanner) Cancel() {
+	if h, err := s.handle("Cancel"); err == nil {
+		Cancel(h)
+	}
+}
+
+// SetIOMode selects whether Read blocks. See the package level SetIOMode.
+func (s *Scanner) SetIOMode(nonBlocking bool) error {
+	h, err := s.handle("SetIOMode")
+	if err != nil {
+		return err
+	}
+	return s.checkError(SetIOMode(h, nonBlocking))
+}
+
+// GetSelectFd returns a file descriptor that becomes readable when image
+// data is available. See the package level GetSelectFd.
+func (s *Scanner) GetSelectFd() (int, error) {
+	h, err := s.handle("GetSelectFd")
+	if err != nil {
+		return -1, err
+	}
+	fd, err := GetSelectFd(h)
+	return fd, s.checkError(err)
+}
+
+// handle returns the handle of s for operation op, or a LibError wrapping
+// ErrClosed if s is closed.
+func (s *Scanner) handle(op string) (SHandle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, &LibError{Op: op, Err: ErrClosed}
+	}
+	return s.h, nil
+}
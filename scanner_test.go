@@ -0,0 +1,183 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordLogger is a Logger keeping the messages it is given.
+type recordLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *recordLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, fmt.Sprintf(format, v...))
+}
+
+func (l *recordLogger) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.msgs)
+}
+
+// openLeaked opens a Scanner and drops it without closing it, returning
+// its handle.
+func openLeaked(t *testing.T) SHandle {
+	s, err := OpenScanner("fake:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.Handle()
+}
+
+// collectUntil runs the garbage collector until cond holds, failing the
+// test if it does not within a few seconds.
+func collectUntil(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatal("finalizer did not run")
+		}
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestScannerFinalizer(t *testing.T) {
+	f := newFakeBackend()
+	SetBackend(f)
+	Init(0, nil)
+	defer Exit()
+	l := &recordLogger{}
+	SetLogger(l)
+	defer SetLogger(nil)
+
+	h := openLeaked(t)
+	if !f.isOpen(h) {
+		t.Fatal("handle not open")
+	}
+	collectUntil(t, func() bool { return !f.isOpen(h) })
+	if l.count() != 1 {
+		t.Errorf("logged %q, want one warning", l.msgs)
+	}
+}
+
+func TestScannerFinalizerAfterClose(t *testing.T) {
+	f := newFakeBackend()
+	SetBackend(f)
+	Init(0, nil)
+	defer Exit()
+	l := &recordLogger{}
+	SetLogger(l)
+	defer SetLogger(nil)
+
+	s, err := OpenScanner("fake:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	s = nil
+	for i := 0; i < 3; i++ {
+		runtime.GC()
+	}
+	closes := 0
+	for _, c := range f.called() {
+		if c == "Close" {
+			closes++
+		}
+	}
+	if closes != 1 || l.count() != 0 {
+		t.Errorf("handle closed %d times, logged %q", closes, l.msgs)
+	}
+}
+
+func TestScannerCloseOnError(t *testing.T) {
+	f := newFakeBackend()
+	SetBackend(f)
+	Init(0, nil)
+	defer Exit()
+	s, err := OpenScanner("fake:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.CloseOnError = true
+
+	f.failRead = IoError
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	h := s.Handle()
+	if _, err := s.Read(make([]byte, 8)); !errors.Is(err, IoError) {
+		t.Fatalf("Read = %v, want IoError", err)
+	}
+	if f.isOpen(h) || !s.NeedsReopen() {
+		t.Fatal("Read failing with IoError did not close the handle")
+	}
+	if _, err := s.GetParameters(); !errors.Is(err, ErrClosed) {
+		t.Errorf("GetParameters after close = %v, want ErrClosed", err)
+	}
+
+	f.failRead = nil
+	if err := s.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.Read(make([]byte, 8)); n != 8 || err != nil {
+		t.Errorf("Read after Reopen = %d, %v", n, err)
+	}
+}
+
+func TestScannerOnReload(t *testing.T) {
+	f := newFakeBackend()
+	mode := f.option(NameScanMode)
+	// Lineart mode adds a threshold option.
+	f.onSet = func(n SInt) Info {
+		if f.opts[n] != mode || mode.str != "Lineart" {
+			return 0
+		}
+		f.addOption(OptionDescriptor{Name: NameThreshold, Type: TypeInt, Size: 4, Cap: SoftSelect | SoftDetect}, 128)
+		return ReloadOptions | ReloadParams
+	}
+	SetBackend(f)
+	Init(0, nil)
+	defer Exit()
+	s, err := OpenScanner("fake:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var got []Info
+	s.OnReload(func(info Info) { got = append(got, info) })
+
+	res, _, _ := FindOption(s.Handle(), NameScanResolution)
+	if _, err := s.ControlOption(res, ActionSetValue, []SWord{150}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("callback called for an option not requiring a reload: %v", got)
+	}
+	n, _, _ := FindOption(s.Handle(), NameScanMode)
+	if _, err := s.ControlOption(n, ActionSetValue, SString("Lineart\x00")); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != ReloadOptions|ReloadParams {
+		t.Errorf("callback called with %v, want one ReloadOptions|ReloadParams", got)
+	}
+	if _, _, err := FindOption(s.Handle(), NameThreshold); err != nil {
+		t.Errorf("added option not found after the reload: %v", err)
+	}
+}
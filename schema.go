@@ -0,0 +1,106 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// jsonSchema is the subset of JSON Schema (draft 7) produced by
+// OptionSchema.
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	MultipleOf           *float64               `json:"multipleOf,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+}
+
+// optionValueSchema returns the schema of a single element of the value of
+// the option described by d.
+func optionValueSchema(d *OptionDescriptor) *jsonSchema {
+	s := &jsonSchema{}
+	switch d.Type {
+	case TypeBool:
+		s.Type = "boolean"
+	case TypeInt:
+		s.Type = "integer"
+	case TypeFixed:
+		s.Type = "number"
+	case TypeString:
+		s.Type = "string"
+		// One byte is taken by the NUL terminator.
+		max := int(d.Size) - 1
+		s.MaxLength = &max
+	}
+
+	switch c := d.Constraint.(type) {
+	case RangeConstraint:
+		min, max, quant, _ := d.RangeInfo()
+		s.Minimum, s.Maximum = &min, &max
+		// multipleOf is relative to 0, so it only describes the steps of
+		// ranges starting at a multiple of the step.
+		if quant > 0 && math.Mod(min, quant) == 0 {
+			s.MultipleOf = &quant
+		}
+	case WordListConstraint:
+		for _, w := range c {
+			if d.Type == TypeInt {
+				s.Enum = append(s.Enum, int(w))
+			} else {
+				s.Enum = append(s.Enum, wordToFloat(d.Type, w))
+			}
+		}
+	case StringListConstraint:
+		for _, v := range c {
+			s.Enum = append(s.Enum, string(v))
+		}
+	}
+	return s
+}
+
+// OptionSchema returns a JSON Schema (draft 7) describing the settable
+// options of h, from which web frontends can generate a settings form. It
+// describes an object with one property per option, keyed by name, giving
+// its type, title, description and allowed values: an enum for list
+// constraints and minimum, maximum and step for ranges. Values are typed as
+// returned by OptionValues, so vectors are arrays.
+func OptionSchema(h SHandle) ([]byte, error) {
+	ds, err := GetOptionDescriptors(h)
+	if err != nil {
+		return nil, err
+	}
+	no := false
+	root := &jsonSchema{
+		Schema:               "http://json-schema.org/draft-07/schema#",
+		Type:                 "object",
+		Properties:           make(map[string]*jsonSchema),
+		AdditionalProperties: &no,
+	}
+	for n := 1; n < len(ds); n++ {
+		d := ds[n]
+		if d == nil || !settable(d) {
+			continue
+		}
+		s := optionValueSchema(d)
+		if d.Type != TypeString && d.Size > 4 {
+			count := int(d.Size / 4)
+			s = &jsonSchema{Type: "array", Items: s, MinItems: &count, MaxItems: &count}
+		}
+		s.Title, s.Description = string(d.Title), string(d.Desc)
+		root.Properties[string(d.Name)] = s
+	}
+	return json.MarshalIndent(root, "", "  ")
+}
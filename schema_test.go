@@ -0,0 +1,149 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// validate checks v, as decoded by encoding/json, against the subset of
+// JSON Schema used by OptionSchema.
+func (s *jsonSchema) validate(v interface{}) error {
+	switch s.Type {
+	case "object":
+		o, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%v is not an object", v)
+		}
+		for k, e := range o {
+			p, ok := s.Properties[k]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("unknown property %q", k)
+				}
+				continue
+			}
+			if err := p.validate(e); err != nil {
+				return fmt.Errorf("%s: %v", k, err)
+			}
+		}
+		return nil
+	case "array":
+		a, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%v is not an array", v)
+		}
+		if (s.MinItems != nil && len(a) < *s.MinItems) || (s.MaxItems != nil && len(a) > *s.MaxItems) {
+			return fmt.Errorf("%d items", len(a))
+		}
+		for _, e := range a {
+			if err := s.Items.validate(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%v is not a boolean", v)
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%v is not a string", v)
+		}
+		if s.MaxLength != nil && len(str) > *s.MaxLength {
+			return fmt.Errorf("%q is too long", str)
+		}
+	case "integer", "number":
+		x, ok := v.(float64)
+		if !ok || (s.Type == "integer" && x != math.Trunc(x)) {
+			return fmt.Errorf("%v is not an %s", v, s.Type)
+		}
+		if (s.Minimum != nil && x < *s.Minimum) || (s.Maximum != nil && x > *s.Maximum) {
+			return fmt.Errorf("%v is out of range", x)
+		}
+		if s.MultipleOf != nil && math.Mod(x, *s.MultipleOf) != 0 {
+			return fmt.Errorf("%v is not a multiple of %v", x, *s.MultipleOf)
+		}
+	}
+	if s.Enum != nil {
+		for _, e := range s.Enum {
+			if reflect.DeepEqual(e, v) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%v is not one of %v", v, s.Enum)
+	}
+	return nil
+}
+
+func TestOptionSchema(t *testing.T) {
+	f := newFakeBackend()
+	f.addOption(OptionDescriptor{Name: NamePreview, Title: "Preview", Type: TypeBool, Size: 4,
+		Cap: SoftSelect | SoftDetect}, SWord(SFALSE))
+	f.addOption(OptionDescriptor{Name: "gamma-table", Type: TypeInt, Size: 4 * 4,
+		Cap: SoftSelect | SoftDetect, Constraint: RangeConstraint{SRange{Min: 0, Max: 255, Quant: 1}}}, 128)
+	// Read-only options are not part of the form.
+	f.addOption(OptionDescriptor{Name: "lamp-hours", Type: TypeInt, Size: 4, Cap: SoftDetect}, 1000)
+	h := setupFake(t, f)
+	defer Exit()
+
+	b, err := OptionSchema(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s jsonSchema
+	if err := json.Unmarshal(b, &s); err != nil {
+		t.Fatalf("invalid schema: %v\n%s", err, b)
+	}
+	if _, ok := s.Properties["lamp-hours"]; ok {
+		t.Error("schema describes a read-only option")
+	}
+	if p := s.Properties[string(NamePreview)]; p == nil || p.Type != "boolean" || p.Title != "Preview" {
+		t.Errorf("preview property %+v", p)
+	}
+
+	values, err := OptionValues(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(values, "lamp-hours")
+	vb, err := json.Marshal(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(vb, &v); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.validate(v); err != nil {
+		t.Errorf("current values %s do not validate: %v", vb, err)
+	}
+
+	for _, c := range []struct {
+		name string
+		v    interface{}
+	}{
+		{string(NameScanResolution), 200.0},
+		{string(NameScanMode), "Sepia"},
+		{string(NameScanBRX), 300.0},
+		{string(NamePreview), "yes"},
+		{"gamma-table", []interface{}{1.0, 2.0}},
+		{"lamp-hours", 0.0},
+	} {
+		bad := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			bad[k] = e
+		}
+		bad[c.name] = c.v
+		if err := s.validate(bad); err == nil {
+			t.Errorf("%s = %v validates", c.name, c.v)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import "strings"
+
+// TitleSensors is the title of the group holding the sensors of a device,
+// such as its buttons, as defined by saneopts.h.
+const TitleSensors SStringConst = "Sensors"
+
+// ReadSensors returns the current values of the sensors of h, keyed by
+// option name and typed as by OptionValues: the active options of its
+// sensors group that software can read. Scanners with physical buttons
+// report them there as booleans (e.g. "scan" or "email"), so an application
+// can poll ReadSensors to start a scan when a button is pressed.
+// Unsupported is returned if h has no sensors group.
+//
+// Each call reads every sensor, which many backends do by querying the
+// device over USB, and some only latch a press until the next read. Polling
+// a few times a second is responsive enough for a button; much faster
+// polling loads the bus for no benefit. Don't poll while h is acquiring,
+// since backends commonly stop reporting sensors during a scan.
+func ReadSensors(h SHandle) (map[string]interface{}, error) {
+	ds, err := GetOptionDescriptors(h)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	for n := 1; n < len(ds); n++ {
+		d := ds[n]
+		if d == nil {
+			continue
+		}
+		if d.Type == TypeGroup {
+			if values != nil {
+				break
+			}
+			if isSensorsGroup(h, SInt(n)) {
+				values = make(map[string]interface{})
+			}
+			continue
+		}
+		if values == nil || !hasValue(d) || d.Cap&SoftDetect == 0 || d.Cap&Inactive != 0 {
+			continue
+		}
+		v, err := getOptionValue(h, SInt(n), d)
+		if err != nil {
+			return nil, err
+		}
+		values[string(d.Name)] = typedValue(d, v)
+	}
+	if values == nil {
+		return nil, Unsupported
+	}
+	return values, nil
+}
+
+// isSensorsGroup reports whether group option n of h is the sensors group.
+// The title is compared as reported by the backend, since the one returned
+// by GetOptionDescriptor is translated.
+func isSensorsGroup(h SHandle, n SInt) bool {
+	d := backend.GetOptionDescriptor(h, n)
+	return d != nil && strings.EqualFold(string(decodeString(d.Title)), string(TitleSensors))
+}
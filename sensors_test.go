@@ -0,0 +1,69 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReadSensorsTranslated(t *testing.T) {
+	f := newFakeBackend()
+	f.addOption(OptionDescriptor{Title: "Sensors", Type: TypeGroup}, nil)
+	f.addOption(OptionDescriptor{Name: "scan", Type: TypeBool, Size: 4, Cap: SoftDetect | HardSelect}, STRUE)
+	f.addOption(OptionDescriptor{Name: "email", Type: TypeBool, Size: 4, Cap: SoftDetect | HardSelect}, SFALSE)
+	f.addOption(OptionDescriptor{Title: "Advanced", Type: TypeGroup}, nil)
+	f.addOption(OptionDescriptor{Name: "lamp-off", Type: TypeBool, Size: 4, Cap: SoftSelect | SoftDetect}, SFALSE)
+	h := setupFake(t, f)
+	defer Exit()
+	SetTranslator(func(key, text string) string {
+		if text == "Sensors" {
+			return "Sensoren"
+		}
+		return text
+	})
+	defer SetTranslator(nil)
+
+	got, err := ReadSensors(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"scan": true, "email": false}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadSensors = %v, want %v", got, want)
+	}
+}
+
+func TestReadSensorsButtonPress(t *testing.T) {
+	f := newFakeBackend()
+	f.addOption(OptionDescriptor{Title: "Sensors", Type: TypeGroup}, nil)
+	f.addOption(OptionDescriptor{Name: "scan", Type: TypeBool, Size: 4, Cap: SoftDetect | HardSelect}, SWord(SFALSE))
+	h := setupFake(t, f)
+	defer Exit()
+
+	for _, pressed := range []bool{false, true, false} {
+		f.mu.Lock()
+		f.option("scan").words[0] = SWord(SFALSE)
+		if pressed {
+			f.option("scan").words[0] = SWord(STRUE)
+		}
+		f.mu.Unlock()
+		got, err := ReadSensors(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got["scan"] != pressed {
+			t.Errorf("scan sensor %v, want %v", got["scan"], pressed)
+		}
+	}
+}
+
+func TestReadSensorsUnsupported(t *testing.T) {
+	h := setupFake(t, newFakeBackend())
+	defer Exit()
+	if _, err := ReadSensors(h); err != Unsupported {
+		t.Errorf("ReadSensors = %v, want Unsupported", err)
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"reflect"
+)
+
+// State holds the values of the options of a device, as captured by
+// Snapshot.
+type State struct {
+	values []optionValue
+}
+
+// optionValue is the raw value of an option: words for TypeBool, TypeInt
+// and TypeFixed options, str for TypeString options.
+type optionValue struct {
+	name  SStringConst
+	words []SWord
+	str   string
+}
+
+// hasValue reports whether options described by d hold a value.
+func hasValue(d *OptionDescriptor) bool {
+	return d.Type != TypeButton && d.Type != TypeGroup
+}
+
+// settable reports whether the option described by d can currently be read
+// and set by software.
+func settable(d *OptionDescriptor) bool {
+	return hasValue(d) && d.Cap&SoftSelect != 0 && d.Cap&SoftDetect != 0 && d.Cap&Inactive == 0
+}
+
+// getOptionValue reads the raw value of option n of h, described by d.
+func getOptionValue(h SHandle, n SInt, d *OptionDescriptor) (optionValue, error) {
+	buf := valueBuffer(d)
+	if _, err := ControlOption(h, n, ActionGetValue, buf); err != nil {
+		return optionValue{name: d.Name}, err
+	}
+	return bufferValue(d, buf), nil
+}
+
+// valueBuffer returns a buffer suitable for reading the value of the option
+// described by d with ControlOption.
+func valueBuffer(d *OptionDescriptor) interface{} {
+	if d.Type == TypeString {
+		return make(SString, d.Size)
+	}
+	return make([]SWord, d.Size/4)
+}
+
+// bufferValue returns the raw value held by buf, a buffer returned by
+// valueBuffer for d.
+func bufferValue(d *OptionDescriptor, buf interface{}) optionValue {
+	v := optionValue{name: d.Name}
+	if d.Type == TypeString {
+		v.str = buf.(SString).Text()
+	} else {
+		v.words = buf.([]SWord)
+	}
+	return v
+}
+
+// setOptionValue sets option n of h, described by d, to the raw value v.
+func setOptionValue(h SHandle, n SInt, d *OptionDescriptor, v optionValue) (Info, error) {
+	if d.Type == TypeString {
+		if SInt(len(v.str)) >= d.Size {
+			return 0, Inval
+		}
+		buf := make(SString, d.Size)
+		copy(buf, v.str)
+		return ControlOption(h, n, ActionSetValue, buf)
+	}
+	words := append([]SWord(nil), v.words...)
+	return ControlOption(h, n, ActionSetValue, words)
+}
+
+// Snapshot captures the values of all active options of h that can be read
+// and set by software. Unlike a saved profile, the snapshot is exact and only
+// meant to live in memory, e.g. to try a setting and then revert it with
+// Restore.
+func Snapshot(h SHandle) (State, error) {
+	count, err := optionCount(h)
+	if err != nil {
+		return State{}, err
+	}
+	var s State
+	for n := SInt(1); n < count; n++ {
+		d := GetOptionDescriptor(h, n)
+		if d == nil || !settable(d) {
+			continue
+		}
+		v, err := getOptionValue(h, n, d)
+		if err != nil {
+			return State{}, err
+		}
+		s.values = append(s.values, v)
+	}
+	return s, nil
+}
+
+// Restore sets the options of h back to the values captured in s.
+//
+// Setting an option may change which other options are active or what values
+// they accept, so options are applied in order in repeated passes, each
+// setting only the options that are active and differ from s, until a pass
+// changes nothing.
+func Restore(h SHandle, s State) error {
+	for pass := 0; pass <= len(s.values); pass++ {
+		changed := false
+		for _, v := range s.values {
+			n, d, err := FindOption(h, v.name)
+			if err == Unsupported {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if !settable(d) {
+				continue
+			}
+			cur, err := getOptionValue(h, n, d)
+			if err != nil {
+				return err
+			}
+			if reflect.DeepEqual(cur, v) {
+				continue
+			}
+			if _, err := setOptionValue(h, n, d, v); err != nil {
+				return err
+			}
+			changed = true
+		}
+		if !changed {
+			return nil
+		}
+	}
+	return nil
+}
+
+// IsDefault reports whether the option of h named name holds its default
+// value, e.g. to only offer a "reset to default" button for changed
+// settings. The default is found by letting the backend pick the value
+// automatically (ActionSetAuto) and reading it back; all options are then
+// restored as with Snapshot and Restore, and the option is set back to its
+// value explicitly so that it does not stay in automatic mode. Unsupported is returned if the
+// option does not have the Automatic capability.
+func IsDefault(h SHandle, name SStringConst) (bool, error) {
+	n, d, err := FindOption(h, name)
+	if err != nil {
+		return false, err
+	}
+	if !hasValue(d) || d.Cap&Automatic == 0 {
+		return false, Unsupported
+	}
+	cur, err := getOptionValue(h, n, d)
+	if err != nil {
+		return false, err
+	}
+	s, err := Snapshot(h)
+	if err != nil {
+		return false, err
+	}
+	if _, err := ControlOption(h, n, ActionSetAuto, nil); err != nil {
+		return false, err
+	}
+	def, err := getOptionValue(h, n, d)
+	if rerr := Restore(h, s); err == nil {
+		err = rerr
+	}
+	// Restore skips options already holding their snapshot value, which
+	// would leave an option at its default in automatic mode.
+	if err == nil {
+		_, err = setOptionValue(h, n, d, cur)
+	}
+	if err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(cur, def), nil
+}
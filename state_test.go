@@ -0,0 +1,104 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"reflect"
+	"testing"
+)
+
+// lineartFake returns a fakeBackend with a threshold option, listed before
+// the mode option it depends on, that is only active in Lineart mode.
+func lineartFake() *fakeBackend {
+	f := newFakeBackend()
+	mode := f.option(NameScanMode)
+	threshold := &fakeOption{desc: OptionDescriptor{Name: NameThreshold, Type: TypeInt, Size: 4,
+		Cap: SoftSelect | SoftDetect | Inactive}, words: []SWord{128}}
+	f.opts = append(f.opts[:1], append([]*fakeOption{threshold}, f.opts[1:]...)...)
+	f.opts[0].words[0] = SWord(len(f.opts))
+	f.onSet = func(n SInt) Info {
+		if f.opts[n] != mode {
+			return 0
+		}
+		if mode.str == "Lineart" {
+			threshold.desc.Cap &^= Inactive
+		} else {
+			threshold.desc.Cap |= Inactive
+		}
+		return ReloadOptions
+	}
+	return f
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	f := lineartFake()
+	h := setupFake(t, f)
+	defer Exit()
+	// The threshold is only active once the mode is set.
+	for _, v := range []map[string]string{{"mode": "Lineart"}, {"threshold": "50"}} {
+		if err := SetOptions(h, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := OptionValues(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Snapshot(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetOptions(h, map[string]string{"mode": "Color", "resolution": "75", "br-x": "100"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := OptionValues(h); reflect.DeepEqual(got, want) {
+		t.Fatal("options not changed")
+	}
+
+	if err := Restore(h, s); err != nil {
+		t.Fatal(err)
+	}
+	got, err := OptionValues(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("restored %v, want %v", got, want)
+	}
+	if th := f.option(NameThreshold).words[0]; th != 50 {
+		t.Errorf("threshold restored to %d, want 50", th)
+	}
+}
+
+func TestIsDefault(t *testing.T) {
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	defer Exit()
+	res := f.option(NameScanResolution)
+
+	// The fake's automatic resolution is 150 dpi.
+	if def, err := IsDefault(h, NameScanResolution); def || err != nil {
+		t.Errorf("IsDefault at 300 dpi = %v, %v; want false", def, err)
+	}
+	if res.words[0] != 300 {
+		t.Errorf("IsDefault left the resolution at %d, want 300", res.words[0])
+	}
+
+	n, _, _ := FindOption(h, NameScanResolution)
+	if _, err := ControlOption(h, n, ActionSetAuto, nil); err != nil {
+		t.Fatal(err)
+	}
+	if def, err := IsDefault(h, NameScanResolution); !def || err != nil {
+		t.Errorf("IsDefault after a reset = %v, %v; want true", def, err)
+	}
+	if res.words[0] != 150 || f.auto[n] {
+		t.Errorf("IsDefault left the resolution at %d, automatic %v; want 150, not automatic", res.words[0], f.auto[n])
+	}
+
+	if _, err := IsDefault(h, NameScanMode); err != Unsupported {
+		t.Errorf("IsDefault of an option without Automatic = %v, want Unsupported", err)
+	}
+}
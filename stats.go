@@ -0,0 +1,66 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"time"
+)
+
+// ScanStats describes the throughput of a scan.
+type ScanStats struct {
+	// Bytes of image data read.
+	Bytes int64
+
+	// Duration from the start of the scan until its last byte was read.
+	Duration time.Duration
+
+	// Reads is the number of Read calls issued.
+	Reads int
+}
+
+// AverageChunk returns the average number of bytes returned per Read.
+func (s ScanStats) AverageChunk() float64 {
+	if s.Reads == 0 {
+		return 0
+	}
+	return float64(s.Bytes) / float64(s.Reads)
+}
+
+// beginScanStats resets the statistics of h at the start of a scan.
+func beginScanStats(h SHandle) {
+	handlesMu.Lock()
+	defer handlesMu.Unlock()
+	if st, ok := handles[h]; ok {
+		st.stats = ScanStats{}
+		st.scanStart = time.Now()
+	}
+}
+
+// addReadStats accounts for a Read of n bytes from h.
+func addReadStats(h SHandle, n int) {
+	handlesMu.Lock()
+	defer handlesMu.Unlock()
+	if st, ok := handles[h]; ok {
+		st.stats.Bytes += int64(n)
+		st.stats.Reads++
+		st.stats.Duration = time.Since(st.scanStart)
+	}
+}
+
+// scanStats returns the statistics of the most recent scan of h.
+func scanStats(h SHandle) ScanStats {
+	handlesMu.Lock()
+	defer handlesMu.Unlock()
+	if st, ok := handles[h]; ok {
+		return st.stats
+	}
+	return ScanStats{}
+}
+
+// LastScanStats returns the statistics of the most recent scan made with
+// the scanner's handle, by any of the high-level scan functions.
+func (s *Scanner) LastScanStats() ScanStats {
+	return scanStats(s.Handle())
+}
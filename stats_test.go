@@ -0,0 +1,52 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLastScanStats(t *testing.T) {
+	f := newFakeBackend()
+	SetBackend(f)
+	Init(0, nil)
+	defer Exit()
+	s, err := OpenScanner("fake:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	f.params = Parameters{Format: FrameGray, LastFrame: STRUE, BytesPerLine: 12, PixelsPerLine: 12, Lines: 10, Depth: 8}
+	f.data = make([]byte, 120)
+	f.chunk = 7
+
+	if st := s.LastScanStats(); st != (ScanStats{}) {
+		t.Errorf("stats before any scan: %+v", st)
+	}
+	if _, err := ScanImage(s.Handle()); err != nil {
+		t.Fatal(err)
+	}
+	st := s.LastScanStats()
+	// 18 reads of data, and one returning Eof.
+	if st.Bytes != 120 || st.Reads != 19 || st.Duration < 0 {
+		t.Errorf("stats %+v, want 120 bytes in 19 reads", st)
+	}
+	if avg := st.AverageChunk(); avg != 120.0/19 {
+		t.Errorf("average chunk %v, want %v", avg, 120.0/19)
+	}
+
+	// Each scan starts afresh.
+	f.chunk = 1 << 20
+	frames, errc := StreamFrames(context.Background(), s.Handle())
+	for range frames {
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if st := s.LastScanStats(); st.Bytes != 120 || st.Reads != 2 {
+		t.Errorf("stats of a streamed frame %+v, want 120 bytes in 2 reads", st)
+	}
+}
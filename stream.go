@@ -0,0 +1,87 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"context"
+	"image"
+)
+
+// ScannedFrame is a single acquired frame, as delivered by StreamFrames.
+type ScannedFrame struct {
+	// Parameters of the frame.
+	Parameters Parameters
+
+	// Image holds the decoded pixels of the frame. Single channel frames
+	// (FrameRed, FrameGreen and FrameBlue) are decoded as gray images.
+	Image image.Image
+}
+
+// StreamFrames acquires frames from h in a new goroutine and sends each one
+// on the returned frame channel as soon as it has been read, until a frame
+// with LastFrame set has been sent or ctx is done. This suits video cameras
+// and other multi-frame devices.
+//
+// Both channels are closed once streaming stops. If it stopped because of an
+// error, such as a Read failing part way through a frame or ctx being done,
+// the error is sent on the error channel first. In every case the goroutine
+// calls Cancel, so that the backend stops acquiring, and exits; the error
+// channel is buffered so that it does not wait for the error to be
+// received.
+func StreamFrames(ctx context.Context, h SHandle) (<-chan ScannedFrame, <-chan error) {
+	frames := make(chan ScannedFrame)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(frames)
+		defer Cancel(h)
+		beginScanStats(h)
+		for {
+			f, err := acquireFrame(ctx, h)
+			if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case frames <- f:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+			if f.Parameters.IsLastFrame() {
+				return
+			}
+		}
+	}()
+	return frames, errc
+}
+
+// acquireFrame starts h and reads and decodes the next frame.
+func acquireFrame(ctx context.Context, h SHandle) (ScannedFrame, error) {
+	if err := ctx.Err(); err != nil {
+		return ScannedFrame{}, err
+	}
+	if err := Start(h); err != nil {
+		return ScannedFrame{}, err
+	}
+	p, err := GetParameters(h)
+	if err != nil {
+		return ScannedFrame{}, err
+	}
+	if err := p.Validate(); err != nil {
+		return ScannedFrame{}, err
+	}
+	stop := setupIOMode(ctx, h)
+	data, err := readFrame(ctx, h, p)
+	stop()
+	if err != nil {
+		return ScannedFrame{}, err
+	}
+	img, err := decodeFrame(p, data)
+	if err != nil {
+		return ScannedFrame{}, err
+	}
+	return ScannedFrame{Parameters: *p, Image: img}, nil
+}
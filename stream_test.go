@@ -0,0 +1,133 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"context"
+	"image"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// waitGoroutines waits for the number of goroutines to drop back to n,
+// failing the test if it does not within a few seconds.
+func waitGoroutines(t *testing.T, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); runtime.NumGoroutine() > n; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left running, want %d", runtime.NumGoroutine(), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// streamFake returns a fakeBackend streaming frames endlessly.
+func streamFake() *fakeBackend {
+	f := newFakeBackend()
+	f.params.LastFrame = SFALSE
+	return f
+}
+
+func TestStreamFramesCancel(t *testing.T) {
+	f := streamFake()
+	h := setupFake(t, f)
+	defer Exit()
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	frames, errc := StreamFrames(ctx, h)
+	if _, ok := <-frames; !ok {
+		t.Fatal("no frame received")
+	}
+	// Stop receiving, leaving the goroutine blocked sending the next frame.
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	for range frames {
+	}
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("StreamFrames ended with %v, want context.Canceled", err)
+	}
+	waitGoroutines(t, before)
+}
+
+func TestStreamFramesCancelDuringRead(t *testing.T) {
+	f := streamFake()
+	f.chunk = 1
+	f.block = make(chan struct{})
+	h := setupFake(t, f)
+	defer Exit()
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	frames, errc := StreamFrames(ctx, h)
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	for range frames {
+		t.Error("frame received from an interrupted Read")
+	}
+	if err := <-errc; err == nil {
+		t.Error("StreamFrames ended without an error")
+	}
+	waitGoroutines(t, before)
+}
+
+func TestStreamFramesClose(t *testing.T) {
+	f := streamFake()
+	f.chunk = 1
+	f.block = make(chan struct{})
+	h := setupFake(t, f)
+	defer Exit()
+	before := runtime.NumGoroutine()
+
+	frames, errc := StreamFrames(context.Background(), h)
+	time.Sleep(10 * time.Millisecond)
+	Close(h)
+	for range frames {
+		t.Error("frame received from a closed handle")
+	}
+	if err := <-errc; err == nil {
+		t.Error("StreamFrames ended without an error")
+	}
+	waitGoroutines(t, before)
+}
+
+func TestStreamFrames(t *testing.T) {
+	const n = 5
+	f := streamFake()
+	started := 0
+	// Frame i is filled with i, and the last one says so.
+	f.onStart = func() error {
+		started++
+		for i := range f.data {
+			f.data[i] = byte(started)
+		}
+		if started == n {
+			f.params.LastFrame = STRUE
+		}
+		return nil
+	}
+	h := setupFake(t, f)
+	defer Exit()
+
+	frames, errc := StreamFrames(context.Background(), h)
+	got := 0
+	for fr := range frames {
+		got++
+		g, ok := fr.Image.(*image.Gray)
+		if !ok || g.Pix[0] != byte(got) {
+			t.Errorf("frame %d: got %T %v", got, fr.Image, fr.Image)
+		}
+		if last := fr.Parameters.IsLastFrame(); last != (got == n) {
+			t.Errorf("frame %d: LastFrame %v", got, last)
+		}
+	}
+	if err, ok := <-errc; err != nil || ok {
+		t.Errorf("error channel = %v, %v; want closed without an error", err, ok)
+	}
+	if got != n {
+		t.Errorf("received %d frames, want %d", got, n)
+	}
+}
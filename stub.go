@@ -0,0 +1,44 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+// stubBackend is a Backend for systems without any usable scanner access.
+// It initializes successfully, reports no devices and fails every other
+// operation with Unsupported. Building with the gosane_stub tag installs it
+// as the default backend.
+type stubBackend struct{}
+
+func (stubBackend) Init(authorize AuthorizationCallback) (SInt, error) {
+	return VersionCode(CurrentMajor, CurrentMinor, 0), nil
+}
+func (stubBackend) Exit()                                                   {}
+func (stubBackend) GetDevices(localOnly bool) ([]Device, error)             { return nil, nil }
+func (stubBackend) Open(name SStringConst) (SHandle, error)                 { return nil, Unsupported }
+func (stubBackend) Close(h SHandle)                                         {}
+func (stubBackend) GetOptionDescriptor(h SHandle, n SInt) *OptionDescriptor { return nil }
+func (stubBackend) ControlOption(h SHandle, n SInt, a Action, v interface{}) (Info, error) {
+	return 0, Unsupported
+}
+func (stubBackend) GetParameters(h SHandle) (*Parameters, error) { return nil, Unsupported }
+func (stubBackend) Start(h SHandle) error                        { return Unsupported }
+func (stubBackend) Read(h SHandle, buf []byte) (int, error)      { return 0, Unsupported }
+func (stubBackend) Cancel(h SHandle)                             {}
+func (stubBackend) SetIOMode(h SHandle, nonBlocking bool) error  { return Unsupported }
+func (stubBackend) GetSelectFd(h SHandle) (int, error)           { return -1, Unsupported }
+
+// Available reports whether a real Backend is installed, so that
+// applications can disable their scanning features cleanly on systems
+// without scanner access. It returns false with a nil error for the stub
+// backend installed by the gosane_stub build tag, and false with an error
+// wrapping ErrNoBackend when no backend is installed at all.
+func Available() (bool, error) {
+	switch backend.(type) {
+	case nil:
+		return false, &LibError{Op: "Available", Err: ErrNoBackend}
+	case stubBackend:
+		return false, nil
+	}
+	return true, nil
+}
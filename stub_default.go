@@ -0,0 +1,12 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+//go:build gosane_stub
+// +build gosane_stub
+
+package gosane
+
+func init() {
+	backend = stubBackend{}
+}
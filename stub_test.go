@@ -0,0 +1,40 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAvailable(t *testing.T) {
+	defer SetBackend(backend)
+
+	SetBackend(stubBackend{})
+	if ok, err := Available(); ok || err != nil {
+		t.Errorf("Available with the stub backend = %v, %v; want false, nil", ok, err)
+	}
+	// The stub still lets applications initialize and list devices.
+	if err := Init(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if devs, err := GetDevices(false); len(devs) != 0 || err != nil {
+		t.Errorf("stub GetDevices = %v, %v", devs, err)
+	}
+	if _, err := Open("test:0"); !errors.Is(err, Unsupported) {
+		t.Errorf("stub Open = %v, want Unsupported", err)
+	}
+	Exit()
+
+	SetBackend(nil)
+	if ok, err := Available(); ok || !errors.Is(err, ErrNoBackend) {
+		t.Errorf("Available without a backend = %v, %v; want false, ErrNoBackend", ok, err)
+	}
+
+	SetBackend(newFakeBackend())
+	if ok, err := Available(); !ok || err != nil {
+		t.Errorf("Available with a backend = %v, %v; want true, nil", ok, err)
+	}
+}
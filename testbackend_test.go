@@ -0,0 +1,138 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import "testing"
+
+// Options of the SANE "test" backend that make it misbehave on purpose, so
+// that error paths can be exercised deterministically.
+const (
+	nameEnableTestOptions SStringConst = "enable-test-options"
+	nameReadReturnValue   SStringConst = "read-return-value"
+	nameFuzzyParameters   SStringConst = "fuzzy-parameters"
+)
+
+// statusNames maps each SStatus to its name in the C API, which is how the
+// test backend's read-return-value option spells it.
+var statusNames = [...]string{
+	Good:         "SANE_STATUS_GOOD",
+	Unsupported:  "SANE_STATUS_UNSUPPORTED",
+	Cancelled:    "SANE_STATUS_CANCELLED",
+	DeviceBusy:   "SANE_STATUS_DEVICE_BUSY",
+	Inval:        "SANE_STATUS_INVAL",
+	Eof:          "SANE_STATUS_EOF",
+	Jammed:       "SANE_STATUS_JAMMED",
+	NoDocs:       "SANE_STATUS_NO_DOCS",
+	CoverOpen:    "SANE_STATUS_COVER_OPEN",
+	IoError:      "SANE_STATUS_IO_ERROR",
+	NoMem:        "SANE_STATUS_NO_MEM",
+	AccessDenied: "SANE_STATUS_ACCESS_DENIED",
+}
+
+// enableTestOptions enables the special options of the test backend opened
+// as h.
+func enableTestOptions(h SHandle) error {
+	_, err := setBoolOption(h, nameEnableTestOptions, true)
+	return err
+}
+
+// setReadReturnValue makes every Read on the test backend opened as h
+// return status. Good restores the default behaviour.
+func setReadReturnValue(h SHandle, status SStatus) error {
+	v := "Default"
+	if status != Good {
+		if int(status) >= len(statusNames) {
+			return Inval
+		}
+		v = statusNames[status]
+	}
+	_, err := setStringOption(h, nameReadReturnValue, v)
+	return err
+}
+
+// setFuzzyParameters makes the test backend opened as h report inexact
+// parameters before Start, as hand-held scanners do.
+func setFuzzyParameters(h SHandle, fuzzy bool) error {
+	_, err := setBoolOption(h, nameFuzzyParameters, fuzzy)
+	return err
+}
+
+// newTestBackendFake returns a fakeBackend with the special options of the
+// test backend, which behave as they do there: read-return-value and
+// fuzzy-parameters are inactive until enable-test-options is set, and
+// read-return-value makes every Read fail with the status it names.
+func newTestBackendFake() *fakeBackend {
+	f := newFakeBackend()
+	enable := f.addOption(OptionDescriptor{Name: nameEnableTestOptions, Type: TypeBool, Size: 4,
+		Cap: SoftSelect | SoftDetect}, SFALSE)
+	values := StringListConstraint{"Default"}
+	for _, name := range statusNames {
+		values = append(values, SStringConst(name))
+	}
+	read := f.addOption(OptionDescriptor{Name: nameReadReturnValue, Type: TypeString, Size: 32,
+		Cap: SoftSelect | SoftDetect | Inactive, Constraint: values}, "Default")
+	fuzzy := f.addOption(OptionDescriptor{Name: nameFuzzyParameters, Type: TypeBool, Size: 4,
+		Cap: SoftSelect | SoftDetect | Inactive}, SFALSE)
+	f.onSet = func(n SInt) Info {
+		switch n {
+		case enable:
+			for _, m := range []SInt{read, fuzzy} {
+				if f.opts[enable].words[0] == STRUE {
+					f.opts[m].desc.Cap &^= Inactive
+				} else {
+					f.opts[m].desc.Cap |= Inactive
+				}
+			}
+			return ReloadOptions
+		case read:
+			f.failRead = nil
+			for status, name := range statusNames {
+				if name == f.opts[read].str && SStatus(status) != Good {
+					f.failRead = SStatus(status)
+				}
+			}
+		}
+		return 0
+	}
+	return f
+}
+
+func TestTestBackendReadReturnValue(t *testing.T) {
+	f := newTestBackendFake()
+	h := setupFake(t, f)
+	defer Exit()
+
+	if err := setReadReturnValue(h, Jammed); err == nil {
+		t.Fatal("read-return-value set before enable-test-options")
+	}
+	if err := enableTestOptions(h); err != nil {
+		t.Fatal(err)
+	}
+	if err := setFuzzyParameters(h, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := setReadReturnValue(h, Jammed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ScanImage(h); err != Jammed {
+		t.Errorf("ScanImage with read-return-value Jammed: %v", err)
+	}
+	if err := setReadReturnValue(h, Eof); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ScanImage(h); err != ErrEmptyFrame {
+		t.Errorf("ScanImage with read-return-value Eof: %v, want ErrEmptyFrame", err)
+	}
+	if err := setReadReturnValue(h, Good); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ScanImage(h); err != nil {
+		t.Errorf("ScanImage with the default read-return-value: %v", err)
+	}
+	if err := setReadReturnValue(h, SStatus(len(statusNames))); err != Inval {
+		t.Errorf("unknown status: %v, want Inval", err)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// Call is a Backend method call recorded by the backend returned by
+// NewTraceBackend.
+type Call struct {
+	// Op is the name of the Backend method, e.g. "Start".
+	Op string
+
+	// Args are the arguments of the call, excluding the handle. Read
+	// records the length of its buffer rather than the buffer itself.
+	Args []interface{}
+}
+
+// traceBackend records calls instead of talking to hardware, returning
+// canned successes. Every device has no options besides option 0 and
+// produces a single 1x1 FrameGray frame.
+type traceBackend struct {
+	mu    sync.Mutex
+	calls *[]Call
+	read  bool
+}
+
+// NewTraceBackend returns a dry-run Backend which records the sequence of
+// calls made to it into the returned slice instead of performing them. It is
+// meant for testing code layered on top of gosane: install it with
+// SetBackend and assert on the exact calls made.
+func NewTraceBackend() (Backend, *[]Call) {
+	calls := new([]Call)
+	return &traceBackend{calls: calls}, calls
+}
+
+func (t *traceBackend) record(op string, args ...interface{}) {
+	*t.calls = append(*t.calls, Call{Op: op, Args: args})
+}
+
+func (t *traceBackend) Init(authorize AuthorizationCallback) (SInt, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record("Init")
+	return VersionCode(CurrentMajor, CurrentMinor, 0), nil
+}
+
+func (t *traceBackend) Exit() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record("Exit")
+}
+
+func (t *traceBackend) GetDevices(localOnly bool) ([]Device, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record("GetDevices", localOnly)
+	return nil, nil
+}
+
+func (t *traceBackend) Open(name SStringConst) (SHandle, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record("Open", name)
+	return SHandle(unsafe.Pointer(new(byte))), nil
+}
+
+func (t *traceBackend) Close(h SHandle) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record("Close")
+}
+
+var traceNumOptions = OptionDescriptor{
+	Name:  NameNumOptions,
+	Title: "Number of options",
+	Type:  TypeInt,
+	Size:  4,
+	Cap:   SoftDetect,
+}
+
+func (t *traceBackend) GetOptionDescriptor(h SHandle, n SInt) *OptionDescriptor {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record("GetOptionDescriptor", n)
+	if n != 0 {
+		return nil
+	}
+	d := traceNumOptions
+	return &d
+}
+
+func (t *traceBackend) ControlOption(h SHandle, n SInt, a Action, v interface{}) (Info, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record("ControlOption", n, a)
+	if n != 0 {
+		return 0, Inval
+	}
+	if w, ok := v.([]SWord); ok && a == ActionGetValue && len(w) > 0 {
+		w[0] = 1
+	}
+	return 0, nil
+}
+
+func (t *traceBackend) GetParameters(h SHandle) (*Parameters, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record("GetParameters")
+	return &Parameters{
+		Format:        FrameGray,
+		LastFrame:     STRUE,
+		BytesPerLine:  1,
+		PixelsPerLine: 1,
+		Lines:         1,
+		Depth:         8,
+	}, nil
+}
+
+func (t *traceBackend) Start(h SHandle) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record("Start")
+	t.read = false
+	return nil
+}
+
+func (t *traceBackend) Read(h SHandle, buf []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record("Read", len(buf))
+	if t.read || len(buf) == 0 {
+		return 0, Eof
+	}
+	t.read = true
+	buf[0] = 0xff
+	return 1, nil
+}
+
+func (t *traceBackend) Cancel(h SHandle) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record("Cancel")
+}
+
+func (t *traceBackend) SetIOMode(h SHandle, nonBlocking bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record("SetIOMode", nonBlocking)
+	return nil
+}
+
+func (t *traceBackend) GetSelectFd(h SHandle) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record("GetSelectFd")
+	return -1, Unsupported
+}
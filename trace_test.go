@@ -0,0 +1,55 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTraceBackendOrder(t *testing.T) {
+	b, calls := NewTraceBackend()
+	SetBackend(b)
+	if err := Init(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	h, err := Open("trace")
+	if err != nil {
+		Exit()
+		t.Fatal(err)
+	}
+	img, err := ScanImage(h)
+	if err != nil {
+		t.Error(err)
+	} else if img.Bounds().Dx() != 1 || img.Bounds().Dy() != 1 {
+		t.Errorf("scanned a %v image, want 1x1", img.Bounds())
+	}
+	Close(h)
+	Exit()
+
+	var ops []string
+	for _, c := range *calls {
+		ops = append(ops, c.Op)
+	}
+	// ScanImage looks up the compression option, then acquires the frame,
+	// reading until Eof, and ends the scan with Cancel.
+	want := []string{
+		"Init", "Open",
+		"ControlOption", "GetOptionDescriptor",
+		"Start", "GetParameters", "Read", "Read", "Cancel",
+		"Close", "Exit",
+	}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("calls %v, want %v", ops, want)
+	}
+	if c := (*calls)[1]; !reflect.DeepEqual(c.Args, []interface{}{SStringConst("trace")}) {
+		t.Errorf("Open recorded %v, want the device name", c.Args)
+	}
+	for _, c := range *calls {
+		if c.Op == "Read" && c.Args[0].(int) <= 0 {
+			t.Errorf("Read recorded buffer length %v", c.Args[0])
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"sync"
+)
+
+var (
+	translatorMu sync.RWMutex
+	translator   func(key, text string) string
+)
+
+// SetTranslator installs f to translate the human readable strings returned
+// by GetOptionDescriptor (Title and Desc) and GetDevices (DeviceType and
+// Comment), e.g. with gettext. key is the name of the option or device the
+// text belongs to and text is the original string, which f returns
+// translated. Passing nil restores the default of no translation.
+func SetTranslator(f func(key, text string) string) {
+	translatorMu.Lock()
+	translator = f
+	translatorMu.Unlock()
+}
+
+func currentTranslator() func(key, text string) string {
+	translatorMu.RLock()
+	defer translatorMu.RUnlock()
+	return translator
+}
+
+// translateDescriptor returns a copy of d with its human readable strings
+// decoded with decodeString and translated.
+func translateDescriptor(d *OptionDescriptor) *OptionDescriptor {
+	if d == nil {
+		return nil
+	}
+	t := *d
+	t.Title = decodeString(d.Title)
+	t.Desc = decodeString(d.Desc)
+	if tr := currentTranslator(); tr != nil {
+		t.Title = SStringConst(tr(string(d.Name), string(t.Title)))
+		t.Desc = SStringConst(tr(string(d.Name), string(t.Desc)))
+	}
+	return &t
+}
+
+// translateDevices returns a copy of devs with their human readable strings
+// decoded with decodeString and translated.
+func translateDevices(devs []Device) []Device {
+	tr := currentTranslator()
+	t := make([]Device, len(devs))
+	for i, d := range devs {
+		d.Vendor = decodeString(d.Vendor)
+		d.Model = decodeString(d.Model)
+		d.DeviceType = decodeString(d.DeviceType)
+		d.BackendAuthorEmail = decodeString(d.BackendAuthorEmail)
+		d.DeviceLocation = decodeString(d.DeviceLocation)
+		d.Comment = decodeString(d.Comment)
+		if tr != nil {
+			d.DeviceType = SStringConst(tr(string(d.Name), string(d.DeviceType)))
+			d.Comment = SStringConst(tr(string(d.Name), string(d.Comment)))
+		}
+		t[i] = d
+	}
+	return t
+}
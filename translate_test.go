@@ -0,0 +1,58 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetTranslator(t *testing.T) {
+	f := newFakeBackend()
+	mode := f.option(NameScanMode)
+	mode.desc.Title = "Scan mode"
+	mode.desc.Desc = "Selects the scan mode."
+	f.devices[0].Comment = "USB"
+	h := setupFake(t, f)
+	defer Exit()
+	var keys []string
+	SetTranslator(func(key, text string) string {
+		keys = append(keys, key)
+		return strings.ToUpper(text)
+	})
+	defer SetTranslator(nil)
+
+	n, _, err := FindOption(h, NameScanMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys = nil
+	d := GetOptionDescriptor(h, n)
+	if d.Title != "SCAN MODE" || d.Desc != "SELECTS THE SCAN MODE." {
+		t.Errorf("translated descriptor %q, %q", d.Title, d.Desc)
+	}
+	if d.Name != NameScanMode {
+		t.Errorf("option name translated to %q", d.Name)
+	}
+	if mode.desc.Title != "Scan mode" {
+		t.Error("translation modified the backend descriptor")
+	}
+	if keys[0] != string(NameScanMode) {
+		t.Errorf("translator keyed on %q, want the option name", keys[0])
+	}
+
+	devs, err := GetDevices(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if devs[0].DeviceType != "FLATBED SCANNER" || devs[0].Comment != "USB" || devs[0].Model != "Flatbed" {
+		t.Errorf("translated device %+v", devs[0])
+	}
+
+	SetTranslator(nil)
+	if d := GetOptionDescriptor(h, n); d.Title != "Scan mode" {
+		t.Errorf("title %q after removing the translator", d.Title)
+	}
+}
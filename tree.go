@@ -0,0 +1,59 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+// OptionGroup is a group of related options, as delimited by the TypeGroup
+// options of a device.
+type OptionGroup struct {
+	// Title of the group; empty for the root group holding the options
+	// that precede the first TypeGroup option.
+	Title SStringConst
+
+	// Cap holds the capabilities of the TypeGroup option itself.
+	Cap Capabilities
+
+	// Options of the group, in device order.
+	Options []GroupOption
+}
+
+// GroupOption is an option within an OptionGroup.
+type GroupOption struct {
+	// Number of the option, as passed to ControlOption.
+	Number SInt
+
+	// Descriptor of the option. It is a copy whose Cap includes the
+	// Advanced and Hidden capabilities of the group, since those apply to
+	// all options of a group.
+	Descriptor *OptionDescriptor
+}
+
+// OptionTree returns the options of h arranged in their groups, which is how
+// SANE expects a frontend to lay out its settings dialog. The root group is
+// only included if some options precede the first group.
+func OptionTree(h SHandle) ([]OptionGroup, error) {
+	ds, err := GetOptionDescriptors(h)
+	if err != nil {
+		return nil, err
+	}
+	groups := []OptionGroup{{}}
+	for n := 1; n < len(ds); n++ {
+		d := ds[n]
+		if d == nil {
+			continue
+		}
+		if d.Type == TypeGroup {
+			groups = append(groups, OptionGroup{Title: d.Title, Cap: d.Cap})
+			continue
+		}
+		g := &groups[len(groups)-1]
+		opt := *d
+		opt.Cap |= g.Cap & (Advanced | Hidden)
+		g.Options = append(g.Options, GroupOption{Number: SInt(n), Descriptor: &opt})
+	}
+	if len(groups[0].Options) == 0 {
+		groups = groups[1:]
+	}
+	return groups, nil
+}
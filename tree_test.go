@@ -0,0 +1,66 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOptionTree(t *testing.T) {
+	f := newFakeBackend()
+	// resolution, then a "Standard" group holding the mode and an advanced
+	// "Geometry" group holding the four geometry options.
+	standard := &fakeOption{desc: OptionDescriptor{Title: "Standard", Type: TypeGroup}}
+	geometry := &fakeOption{desc: OptionDescriptor{Title: "Geometry", Type: TypeGroup, Cap: Advanced}}
+	opts := append([]*fakeOption{}, f.opts[:2]...)
+	opts = append(opts, standard, f.opts[2], geometry)
+	f.opts = append(opts, f.opts[3:]...)
+	f.opts[0].words[0] = SWord(len(f.opts))
+	h := setupFake(t, f)
+	defer Exit()
+
+	groups, err := OptionTree(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type group struct {
+		title SStringConst
+		names []SStringConst
+		nums  []SInt
+	}
+	var got []group
+	for _, g := range groups {
+		gr := group{title: g.Title}
+		for _, o := range g.Options {
+			gr.names = append(gr.names, o.Descriptor.Name)
+			gr.nums = append(gr.nums, o.Number)
+		}
+		got = append(got, gr)
+	}
+	want := []group{
+		{"", []SStringConst{NameScanResolution}, []SInt{1}},
+		{"Standard", []SStringConst{NameScanMode}, []SInt{3}},
+		{"Geometry", []SStringConst{NameScanTLX, NameScanTLY, NameScanBRX, NameScanBRY}, []SInt{5, 6, 7, 8}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("OptionTree = %+v, want %+v", got, want)
+	}
+	for _, o := range groups[2].Options {
+		if o.Descriptor.Cap&Advanced == 0 {
+			t.Errorf("%s did not inherit Advanced from its group", o.Descriptor.Name)
+		}
+	}
+	if groups[1].Options[0].Descriptor.Cap&Advanced != 0 || f.option(NameScanTLX).desc.Cap&Advanced != 0 {
+		t.Error("Advanced applied outside its group")
+	}
+
+	// Without options before the first group there is no root group.
+	f.opts = append(f.opts[:1], f.opts[2:]...)
+	f.opts[0].words[0] = SWord(len(f.opts))
+	if groups, _ := OptionTree(h); len(groups) != 2 || groups[0].Title != "Standard" {
+		t.Errorf("OptionTree without root options has %d groups", len(groups))
+	}
+}
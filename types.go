@@ -9,19 +9,105 @@
 package gosane
 
 import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sync"
 	"unsafe"
 )
 
+// The SANE version gosane targets.
+const (
+	CurrentMajor = 1
+	CurrentMinor = 0
+)
+
+// VersionCode combines a SANE major, minor and build number into a version
+// code, as done by the SANE_VERSION_CODE macro.
+func VersionCode(major, minor, build int) SInt {
+	return SInt((major&0xff)<<24 | (minor&0xff)<<16 | build&0xffff)
+}
+
+// VersionMajor returns the major number of version code v.
+func VersionMajor(v SInt) int {
+	return int(v>>24) & 0xff
+}
+
+// VersionMinor returns the minor number of version code v.
+func VersionMinor(v SInt) int {
+	return int(v>>16) & 0xff
+}
+
+// VersionBuild returns the build number of version code v.
+func VersionBuild(v SInt) int {
+	return int(v) & 0xffff
+}
+
 // primitive types
 // Type names from the spec of the form `SANE_*` have been shortened to `S*`.
 
 type SByte uint8
 
-// ordered most significant to least significant (big endian)
+// SWord is held in host byte order in memory; on the wire (the SANE network
+// protocol) it is ordered most significant to least significant (big endian).
+// Use Bytes and WordFromBytes to convert to and from the wire format.
 type SWord int32
 
+// Bytes returns w in big endian byte order, as used by the SANE network
+// protocol.
+func (w SWord) Bytes() []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(w))
+	return b
+}
+
+// WordFromBytes decodes a big endian SWord from the first four bytes of b.
+// It panics if b is shorter than four bytes.
+func WordFromBytes(b []byte) SWord {
+	return SWord(binary.BigEndian.Uint32(b))
+}
+
 type SString []byte
 
+// NULPolicy controls how SString.Text, and so every string option value
+// read by gosane, treats NUL bytes.
+type NULPolicy int
+
+const (
+	// TrimAtNUL ends the string at the first NUL, as C does. This is the
+	// default.
+	TrimAtNUL NULPolicy = iota
+
+	// KeepNUL keeps the data following the first NUL, for backends that
+	// embed data after the terminator. Only the NUL bytes padding the end
+	// of the buffer are dropped.
+	KeepNUL
+)
+
+var (
+	nulPolicyMu sync.RWMutex
+	nulPolicy   NULPolicy
+)
+
+// SetNULPolicy sets the NULPolicy used by SString.Text.
+func SetNULPolicy(p NULPolicy) {
+	nulPolicyMu.Lock()
+	nulPolicy = p
+	nulPolicyMu.Unlock()
+}
+
+// Text converts s to a Go string according to the NULPolicy set with
+// SetNULPolicy: by default the string ends at the first NUL.
+func (s SString) Text() string {
+	nulPolicyMu.RLock()
+	p := nulPolicy
+	nulPolicyMu.RUnlock()
+	if p == KeepNUL {
+		return string(bytes.TrimRight(s, "\x00"))
+	}
+	return trimNUL(s)
+}
+
 type SStringConst string
 
 type SBool = SWord
@@ -33,6 +119,57 @@ const (
 
 type SInt = SWord
 
+// SFixed is a fixed-point number stored in an SWord, with the least
+// significant FixedScaleShift bits holding the fractional part.
+type SFixed SWord
+
+// FixedScaleShift is the number of fractional bits in an SFixed.
+const FixedScaleShift = 16
+
+// FixedToFloat converts f to a float64.
+func FixedToFloat(f SFixed) float64 {
+	return float64(f) / (1 << FixedScaleShift)
+}
+
+// Round converts f to a float64 rounded to the given number of decimals, for
+// display. Fixed-point values are rarely exact (300 is often stored as
+// 299.9998...), so use Round when showing values and FixedToFloat when
+// computing with them.
+func (f SFixed) Round(decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(FixedToFloat(f)*p) / p
+}
+
+// FloatToFixed converts v to the nearest SFixed. Values outside FixedRange
+// are clamped to it; use FloatToFixedChecked to detect this.
+func FloatToFixed(v float64) SFixed {
+	f, _ := FloatToFixedChecked(v)
+	return f
+}
+
+// FixedRange returns the smallest and largest SFixed values, which are
+// -32768.0 and 32767.99998 (32768 - 1/65536).
+func FixedRange() (min, max SFixed) {
+	return math.MinInt32, math.MaxInt32
+}
+
+// FloatToFixedChecked is like FloatToFixed, but also reports whether v was
+// outside FixedRange and saturated, e.g. for a resolution too large to be
+// represented. NaN converts to 0 and is reported as saturated.
+func FloatToFixedChecked(v float64) (f SFixed, saturated bool) {
+	min, max := FixedRange()
+	switch s := math.Round(v * (1 << FixedScaleShift)); {
+	case s != s:
+		return 0, true
+	case s < float64(min):
+		return min, true
+	case s > float64(max):
+		return max, true
+	default:
+		return SFixed(s), false
+	}
+}
+
 type SChar byte
 
 // defined as `typedef void *SHandle;`
@@ -179,15 +316,70 @@ type OptionDescriptor struct {
 	// 	TypeButton, TypeGroup:
 	// The option size is ignored.
 
-	Size           SInt
-	Cap            Capabilities
-	ConstraintType ConstraintType
+	Size SInt
+	Cap  Capabilities
+
+	// Constraint restricts the values the option may take. It is one of
+	// NoConstraint, RangeConstraint, WordListConstraint or
+	// StringListConstraint; a nil Constraint is treated as NoConstraint.
 	// This is a C union in the spec.
-	Constraint struct {
-		StringList []SStringConst
-		WordList   []SWord
-		Range      *SRange
+	Constraint Constraint
+}
+
+// ConstraintType returns the type of d.Constraint.
+func (d *OptionDescriptor) ConstraintType() ConstraintType {
+	if d.Constraint == nil {
+		return None
 	}
+	return d.Constraint.Type()
+}
+
+// Clone returns a deep copy of d, whose constraint lists do not share memory
+// with those of d, so that it can be cached and modified safely, e.g. across
+// a ReloadOptions, after which backends may reuse their descriptors. The
+// range of a RangeConstraint is held by value and never shared.
+func (d *OptionDescriptor) Clone() *OptionDescriptor {
+	if d == nil {
+		return nil
+	}
+	c := *d
+	switch l := d.Constraint.(type) {
+	case WordListConstraint:
+		c.Constraint = append(WordListConstraint(nil), l...)
+	case StringListConstraint:
+		c.Constraint = append(StringListConstraint(nil), l...)
+	}
+	return &c
+}
+
+// Range returns the range constraint of d, or nil if d is not constrained by
+// a range. It replaces the former d.Constraint.Range field.
+func (d *OptionDescriptor) Range() *SRange {
+	if c, ok := d.Constraint.(RangeConstraint); ok {
+		r := c.SRange
+		return &r
+	}
+	return nil
+}
+
+// WordList returns the word list constraint of d, or nil if d is not
+// constrained by a word list. It replaces the former d.Constraint.WordList
+// field.
+func (d *OptionDescriptor) WordList() []SWord {
+	if c, ok := d.Constraint.(WordListConstraint); ok {
+		return c
+	}
+	return nil
+}
+
+// StringList returns the string list constraint of d, or nil if d is not
+// constrained by a string list. It replaces the former
+// d.Constraint.StringList field.
+func (d *OptionDescriptor) StringList() []SStringConst {
+	if c, ok := d.Constraint.(StringListConstraint); ok {
+		return c
+	}
+	return nil
 }
 
 type Capabilities SInt
@@ -201,31 +393,31 @@ const (
 	// action to set such an option.
 	// This capability is mutually exclusive with SoftSelect (either one of
 	// them can be set, but not both simultaneously).
-	HardSelect Capabilities = SoftSelect >> 1
+	HardSelect Capabilities = SoftSelect << 1
 
 	// The option value can be detected by software. If SoftSelect is set,
 	// this capability must be set. If HardSelect is set, this capability
 	// may or may not be set. If this capability is set but neither SoftSelect
 	// nor HardSelect are, then there is no way to control the option.
 	// That is, the option provides read-out of the current value only.
-	SoftDetect Capabilities = HardSelect >> 1
+	SoftDetect Capabilities = HardSelect << 1
 
 	// If set, this capability indicates that an option is not directly
 	// supported by the device and is instead emulated in the backend. A
 	// sophisticated frontend may elect to use its own (presumably better)
 	// emulation in lieu of an emulated option.
-	Emulated Capabilities = SoftDetect >> 1
+	Emulated Capabilities = SoftDetect << 1
 
 	// If set, this capability indicates that the backend (or the device) is
 	// capable to picking a reasonable option value automatically. For such
 	// options, it is possible to select automatic operation by calling
 	// ControlOption() with an action value of ActionSetAuto.
-	Automatic Capabilities = Emulated >> 1
+	Automatic Capabilities = Emulated << 1
 
 	// If set, this capability indicates that the option is not currently
 	// active (e.g., because it's meaningful only if another option is set
 	// to some other value).
-	Inactive Capabilities = Automatic >> 1
+	Inactive Capabilities = Automatic << 1
 
 	// If set, this capability indicates that the option should be considered
 	// an ``advanced user option''. If this capability is set for an option
@@ -235,7 +427,7 @@ const (
 	// (e.g., a command line interface may list such options last or a
 	// graphical interface may make them available in a seperate ``advanced
 	// settings'' dialog).
-	Advanced Capabilities = Inactive >> 1
+	Advanced Capabilities = Inactive << 1
 
 	// If set, this capability indicates that the option shouldn't be displayed
 	// to and used by the user directly. Instead a hidden option is supposed
@@ -245,14 +437,19 @@ const (
 	// set the capabilty themselves. A frontend typically doesn't display
 	// such options by default but there should be a way to override this
 	// default behaviour.
-	Hidden Capabilities = Advanced >> 1
+	Hidden Capabilities = Advanced << 1
 
 	// If set, this capability indicates that the option may be at any time
 	// between Open() and Close(). I.e. it's allowed to set it even while an
 	// image is acquired.
-	AlwaysSettable Capabilities = Hidden >> 1
+	AlwaysSettable Capabilities = Hidden << 1
 )
 
+// IsEmulated reports whether c has the Emulated capability.
+func (c Capabilities) IsEmulated() bool {
+	return c&Emulated != 0
+}
+
 type ConstraintType SInt
 
 const (
@@ -268,6 +465,35 @@ type SRange struct {
 	Quant SWord
 }
 
+// Constraint restricts the values an option may take.
+type Constraint interface {
+	Type() ConstraintType
+}
+
+// NoConstraint means the option may take any value of its type.
+type NoConstraint struct{}
+
+func (NoConstraint) Type() ConstraintType { return None }
+
+// RangeConstraint restricts a TypeInt or TypeFixed option to a range. A Quant
+// of 0 means the value is not quantized.
+type RangeConstraint struct {
+	SRange
+}
+
+func (RangeConstraint) Type() ConstraintType { return Range }
+
+// WordListConstraint restricts a TypeInt or TypeFixed option to a list of
+// values. Unlike in C, the list does not start with its length.
+type WordListConstraint []SWord
+
+func (WordListConstraint) Type() ConstraintType { return WordList }
+
+// StringListConstraint restricts a TypeString option to a list of values.
+type StringListConstraint []SStringConst
+
+func (StringListConstraint) Type() ConstraintType { return StringList }
+
 type ValueType uint
 
 const (
@@ -321,3 +547,78 @@ const (
 	// Value is time in µ-seconds.
 	UnitMicrosecond
 )
+
+type Action SInt
+
+const (
+	// Get the current value of the option.
+	ActionGetValue Action = iota
+
+	// Set the value of the option.
+	ActionSetValue
+
+	// Turn on automatic mode for the option. Only valid for options with
+	// the Automatic capability.
+	ActionSetAuto
+)
+
+// Info is returned by ControlOption to report the side-effects of setting
+// an option.
+type Info SInt
+
+const (
+	// The value has been rounded to the nearest value the backend supports
+	// and the value buffer has been updated to reflect this.
+	InfoInexact Info = 1 << iota
+
+	// Setting the option may have changed the value, descriptors or
+	// availability of other options; the frontend must reload them.
+	ReloadOptions
+
+	// Setting the option may have changed the scan parameters.
+	ReloadParams
+)
+
+// Frame is the format of the data returned by Read for the current frame.
+type Frame SInt
+
+const (
+	// Band covering human visual range.
+	FrameGray Frame = iota
+
+	// Pixel-interleaved red/green/blue bands.
+	FrameRGB
+
+	// Red band of a red/green/blue image.
+	FrameRed
+
+	// Green band of a red/green/blue image.
+	FrameGreen
+
+	// Blue band of a red/green/blue image.
+	FrameBlue
+)
+
+// Parameters describes the frame that is about to be (or being) acquired.
+type Parameters struct {
+	// Format of the frame.
+	Format Frame
+
+	// LastFrame is STRUE if this is the last frame of the image.
+	LastFrame SBool
+
+	// Number of bytes that make up one scan line, including any padding.
+	BytesPerLine SInt
+
+	// Number of pixels that make up one scan line.
+	PixelsPerLine SInt
+
+	// Number of lines in the frame, or -1 if it is not known in advance
+	// (e.g. for a hand-held scanner).
+	Lines SInt
+
+	// Number of bits per sample. For FrameRGB a pixel holds three samples.
+	// Samples of depth 16 are in host byte order, and samples of depth 1
+	// are packed most significant bit first with 1 meaning black.
+	Depth SInt
+}
@@ -0,0 +1,218 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestSStringText(t *testing.T) {
+	defer SetNULPolicy(TrimAtNUL)
+	s := SString("ab\x00cd\x00\x00")
+	if got := s.Text(); got != "ab" {
+		t.Errorf("TrimAtNUL: %q, want %q", got, "ab")
+	}
+	SetNULPolicy(KeepNUL)
+	if got := s.Text(); got != "ab\x00cd" {
+		t.Errorf("KeepNUL: %q, want %q", got, "ab\x00cd")
+	}
+	if got := fmt.Sprintf("%#v", SString("a")); got != "gosane.SString{0x61}" {
+		t.Errorf("%%#v printed %s", got)
+	}
+}
+
+func TestNULPolicyOptionValues(t *testing.T) {
+	defer SetNULPolicy(TrimAtNUL)
+	f := newFakeBackend()
+	f.option(NameScanMode).str = "Gray\x00v2"
+	h := setupFake(t, f)
+	defer Exit()
+
+	for _, c := range []struct {
+		policy NULPolicy
+		want   string
+	}{{TrimAtNUL, "Gray"}, {KeepNUL, "Gray\x00v2"}} {
+		SetNULPolicy(c.policy)
+		if got, err := getStringOption(h, NameScanMode); got != c.want || err != nil {
+			t.Errorf("policy %d: getStringOption returned %q, %v, want %q", c.policy, got, err, c.want)
+		}
+		if vs, err := OptionValues(h); err != nil || vs["mode"] != c.want {
+			t.Errorf("policy %d: OptionValues returned mode %q, %v, want %q", c.policy, vs["mode"], err, c.want)
+		}
+	}
+}
+
+func TestFloatToFixedChecked(t *testing.T) {
+	const unit = 1.0 / (1 << FixedScaleShift)
+	min, max := FixedRange()
+	for _, c := range []struct {
+		v         float64
+		want      SFixed
+		saturated bool
+	}{
+		{0, 0, false},
+		{1, 1 << FixedScaleShift, false},
+		{0.4 * unit, 0, false},
+		{0.6 * unit, 1, false}, // rounded, not truncated
+		{-0.6 * unit, -1, false},
+		{-32768, min, false},
+		{32768 - unit, max, false},
+		{32768 - 0.6*unit, max, false},
+		{32768 - 0.4*unit, max, true},
+		{32768, max, true},
+		{-32768 - unit, min, true},
+		{math.Inf(1), max, true},
+		{math.Inf(-1), min, true},
+		{math.NaN(), 0, true},
+	} {
+		got, saturated := FloatToFixedChecked(c.v)
+		if got != c.want || saturated != c.saturated {
+			t.Errorf("FloatToFixedChecked(%v) = %d, %v; want %d, %v", c.v, got, saturated, c.want, c.saturated)
+		}
+	}
+}
+
+func TestCapabilitiesValues(t *testing.T) {
+	// The bit values of SANE_CAP_* in sane.h.
+	for _, c := range []struct {
+		name string
+		c    Capabilities
+		want SInt
+	}{
+		{"SoftSelect", SoftSelect, 1},
+		{"HardSelect", HardSelect, 2},
+		{"SoftDetect", SoftDetect, 4},
+		{"Emulated", Emulated, 8},
+		{"Automatic", Automatic, 16},
+		{"Inactive", Inactive, 32},
+		{"Advanced", Advanced, 64},
+		{"Hidden", Hidden, 128},
+		{"AlwaysSettable", AlwaysSettable, 256},
+	} {
+		if SInt(c.c) != c.want {
+			t.Errorf("%s = %d, want %d", c.name, c.c, c.want)
+		}
+	}
+}
+
+func TestConstraintTypes(t *testing.T) {
+	f := newFakeBackend()
+	f.addOption(OptionDescriptor{Name: NamePreview, Type: TypeBool, Size: 4, Cap: SoftSelect | SoftDetect}, SFALSE)
+	h := setupFake(t, f)
+	defer Exit()
+
+	for _, c := range []struct {
+		name SStringConst
+		typ  ConstraintType
+	}{
+		{NameScanResolution, WordList},
+		{NameScanMode, StringList},
+		{NameScanTLX, Range},
+		{NamePreview, None},
+	} {
+		_, d, err := FindOption(h, c.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.ConstraintType() != c.typ {
+			t.Errorf("%s: constraint type %v, want %v", c.name, d.ConstraintType(), c.typ)
+		}
+		var ok bool
+		switch c.typ {
+		case WordList:
+			_, ok = d.Constraint.(WordListConstraint)
+			ok = ok && len(d.WordList()) == 3 && d.Range() == nil
+		case StringList:
+			_, ok = d.Constraint.(StringListConstraint)
+			ok = ok && len(d.StringList()) == 3 && d.WordList() == nil
+		case Range:
+			_, ok = d.Constraint.(RangeConstraint)
+			ok = ok && d.Range() != nil && d.Range().Max == SWord(FloatToFixed(215.9))
+		case None:
+			ok = d.Constraint == nil && d.Range() == nil && d.WordList() == nil && d.StringList() == nil
+		}
+		if !ok {
+			t.Errorf("%s: constraint %#v does not match its type", c.name, d.Constraint)
+		}
+	}
+}
+
+func TestSWordBytes(t *testing.T) {
+	for _, c := range []struct {
+		w    SWord
+		want []byte
+	}{
+		{0, []byte{0, 0, 0, 0}},
+		{1, []byte{0, 0, 0, 1}},
+		{0x01020304, []byte{1, 2, 3, 4}},
+		{-1, []byte{0xff, 0xff, 0xff, 0xff}},
+		{-2, []byte{0xff, 0xff, 0xff, 0xfe}},
+		{SWord(FloatToFixed(1)), []byte{0, 1, 0, 0}},
+	} {
+		if got := c.w.Bytes(); !bytes.Equal(got, c.want) {
+			t.Errorf("%d.Bytes() = %x, want %x", c.w, got, c.want)
+		}
+		if got := WordFromBytes(c.want); got != c.w {
+			t.Errorf("WordFromBytes(%x) = %d, want %d", c.want, got, c.w)
+		}
+	}
+	// The byte order does not depend on the host.
+	if got := binary.LittleEndian.Uint32(SWord(0x0a0b0c0d).Bytes()); got != 0x0d0c0b0a {
+		t.Errorf("Bytes read as little endian = %#x, want 0xd0c0b0a", got)
+	}
+	if got := WordFromBytes([]byte{0, 0, 0, 7, 0xff}); got != 7 {
+		t.Errorf("WordFromBytes with trailing bytes = %d, want 7", got)
+	}
+}
+
+func TestOptionDescriptorClone(t *testing.T) {
+	for _, d := range []*OptionDescriptor{
+		{Name: NameScanResolution, Type: TypeInt, Constraint: WordListConstraint{75, 150, 300}},
+		{Name: NameScanMode, Type: TypeString, Constraint: StringListConstraint{"Color", "Gray"}},
+		{Name: NameScanTLX, Type: TypeFixed, Constraint: RangeConstraint{SRange{Max: 100, Quant: 1}}},
+	} {
+		c := d.Clone()
+		if !reflect.DeepEqual(c, d) {
+			t.Fatalf("%s: clone %+v differs from %+v", d.Name, c, d)
+		}
+		switch l := c.Constraint.(type) {
+		case WordListConstraint:
+			l[0] = 1
+		case StringListConstraint:
+			l[0] = "Sepia"
+		case RangeConstraint:
+			l.Max = 1
+			c.Constraint = l
+		}
+		if reflect.DeepEqual(c.Constraint, d.Constraint) {
+			t.Errorf("%s: changing the clone changed the original to %+v", d.Name, d)
+		}
+	}
+	if (*OptionDescriptor)(nil).Clone() != nil {
+		t.Error("clone of nil is not nil")
+	}
+
+	// A cached clone survives the backend reusing its descriptor.
+	f := newFakeBackend()
+	h := setupFake(t, f)
+	defer Exit()
+	n, d, err := FindOption(h, NameScanResolution)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached := d.Clone()
+	f.option(NameScanResolution).desc.Constraint.(WordListConstraint)[2] = 600
+	if _, err := RefreshOption(h, int(n)); err != nil {
+		t.Fatal(err)
+	}
+	if got := cached.WordList(); !reflect.DeepEqual(got, []SWord{75, 150, 300}) {
+		t.Errorf("cached resolutions %v after a reload, want [75 150 300]", got)
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parseOptionValue converts s to a raw value for the option described by d.
+// Booleans accept "yes", "no", "true", "false", "on", "off", "1" and "0";
+// vectors are given as comma separated lists.
+func parseOptionValue(d *OptionDescriptor, s string) (optionValue, error) {
+	v := optionValue{name: d.Name}
+	if d.Type == TypeString {
+		v.str = s
+		return v, nil
+	}
+	fields := strings.Split(s, ",")
+	if SInt(len(fields)) != d.Size/4 {
+		return v, &LibError{Op: "option " + string(d.Name), Err: fmt.Errorf("want %d values, got %q", d.Size/4, s)}
+	}
+	for _, f := range fields {
+		f = strings.TrimSpace(f)
+		var w SWord
+		switch d.Type {
+		case TypeBool:
+			switch strings.ToLower(f) {
+			case "yes", "true", "on", "1":
+				w = STRUE
+			case "no", "false", "off", "0":
+				w = SFALSE
+			default:
+				return v, typeMismatch(d.Name)
+			}
+		case TypeInt:
+			i, err := strconv.ParseInt(f, 10, 32)
+			if err != nil {
+				return v, typeMismatch(d.Name)
+			}
+			w = SWord(i)
+		case TypeFixed:
+			x, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				return v, typeMismatch(d.Name)
+			}
+			w = SWord(FloatToFixed(x))
+		default:
+			return v, typeMismatch(d.Name)
+		}
+		v.words = append(v.words, w)
+	}
+	return v, nil
+}
+
+// findOptionByNameOrTitle looks key up as an option name, falling back to
+// FindOptionByTitle.
+func findOptionByNameOrTitle(h SHandle, key string) (SInt, *OptionDescriptor, error) {
+	n, d, err := FindOption(h, SStringConst(key))
+	if err == Unsupported {
+		return FindOptionByTitle(h, key)
+	}
+	return n, d, err
+}
+
+// SetOptions sets the options of h from values, which maps option names, or
+// failing that option titles, to values in the text form accepted by
+// parseOptionValue. Options are set in the order the device lists them, so
+// that e.g. the scan mode is set before options that depend on it. Buttons
+// are pressed regardless of their value.
+func SetOptions(h SHandle, values map[string]string) error {
+	type pending struct {
+		n          SInt
+		key, value string
+	}
+	var ps []pending
+	for key, value := range values {
+		n, _, err := findOptionByNameOrTitle(h, key)
+		if err != nil {
+			return err
+		}
+		ps = append(ps, pending{n, key, value})
+	}
+	sort.Slice(ps, func(i, j int) bool { return ps[i].n < ps[j].n })
+
+	for _, p := range ps {
+		if err := setOptionString(h, p.key, p.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setOptionString sets the option of h named or titled key to value, in the
+// text form accepted by parseOptionValue. Buttons are pressed regardless of
+// value.
+func setOptionString(h SHandle, key, value string) error {
+	// Look the option up every time, as setting another option may have
+	// changed it.
+	n, d, err := findOptionByNameOrTitle(h, key)
+	if err != nil {
+		return err
+	}
+	if d.Type == TypeButton {
+		_, err := ControlOption(h, n, ActionSetValue, nil)
+		return err
+	}
+	v, err := parseOptionValue(d, value)
+	if err != nil {
+		return err
+	}
+	_, err = setOptionValue(h, n, d, v)
+	return err
+}
+
+// LoadOptionsFile sets the options of h from the file at path, e.g. for
+// reproducible scan jobs in scripts. Each line holds a "key = value" pair,
+// where key and value are as for SetOptions. Blank lines and comments are
+// ignored; a comment starts with a # at the start of a line or following
+// whitespace, so "source = Tray#1" keeps its #. A value may also be quoted
+// as a Go string literal, e.g. "a # b", or contain \# for a literal #.
+// Options are set in the order of the file. Errors report the line they
+// occurred on.
+func LoadOptionsFile(h SHandle, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := stripComment(sc.Text())
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		i := strings.IndexByte(text, '=')
+		if i < 0 {
+			return fmt.Errorf("%s:%d: missing '='", path, line)
+		}
+		key, value := strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:])
+		value, err := unquoteValue(value)
+		if err != nil {
+			return fmt.Errorf("%s:%d: malformed quoted value", path, line)
+		}
+		if err := setOptionString(h, key, value); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+	return sc.Err()
+}
+
+// stripComment removes the comment from a line of an options file: text
+// from a # at the start of the line or following whitespace, unless quoted
+// or escaped.
+func stripComment(line string) string {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case c == '#' && !quoted && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// unquoteValue returns the value of an options file line: unquoted if it is
+// a quoted Go string literal, else with \# replaced by #.
+func unquoteValue(value string) (string, error) {
+	if strings.HasPrefix(value, `"`) {
+		return strconv.Unquote(value)
+	}
+	return strings.Replace(value, `\#`, "#", -1), nil
+}
+
+// OptionValues returns the current values of the active options of h that
+// can be read by software, keyed by option name. Values are typed after the
+// option: bool for TypeBool, int for TypeInt, float64 for TypeFixed and
+// string for TypeString, or a slice of these for vectors. It is the readable
+// counterpart of SetOptions, e.g. for dumping the state of a device.
+//
+// Backends implementing ValueGetter are asked for all the values at once.
+func OptionValues(h SHandle) (map[string]interface{}, error) {
+	ds, err := GetOptionDescriptors(h)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		ns   []SInt
+		bufs []interface{}
+	)
+	for n := 1; n < len(ds); n++ {
+		d := ds[n]
+		if d == nil || !hasValue(d) || d.Cap&SoftDetect == 0 || d.Cap&Inactive != 0 {
+			continue
+		}
+		ns = append(ns, SInt(n))
+		bufs = append(bufs, valueBuffer(d))
+	}
+	if err := getOptionValues(h, ns, bufs); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]interface{}, len(ns))
+	for i, n := range ns {
+		d := ds[n]
+		values[string(d.Name)] = typedValue(d, bufferValue(d, bufs[i]))
+	}
+	return values, nil
+}
+
+// typedValue converts the raw value v of the option described by d to the
+// Go type documented by OptionValues.
+func typedValue(d *OptionDescriptor, v optionValue) interface{} {
+	switch d.Type {
+	case TypeString:
+		return v.str
+	case TypeBool:
+		bs := make([]bool, len(v.words))
+		for i, w := range v.words {
+			bs[i] = w != SFALSE
+		}
+		if len(bs) == 1 {
+			return bs[0]
+		}
+		return bs
+	case TypeInt:
+		is := make([]int, len(v.words))
+		for i, w := range v.words {
+			is[i] = int(w)
+		}
+		if len(is) == 1 {
+			return is[0]
+		}
+		return is
+	default:
+		fs := make([]float64, len(v.words))
+		for i, w := range v.words {
+			fs[i] = wordToFloat(d.Type, w)
+		}
+		if len(fs) == 1 {
+			return fs[0]
+		}
+		return fs
+	}
+}
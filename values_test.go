@@ -0,0 +1,158 @@
+// Copyright 2019 kdevb0x Ltd. All rights reserved.
+// Use of this source code is governed by the BSD 3-Clause license
+// The full license text can be found in the LICENSE file.
+
+package gosane
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// batchFake is a fakeBackend implementing ValueGetter.
+type batchFake struct {
+	*fakeBackend
+}
+
+func (f batchFake) GetOptionValues(h SHandle, ns []SInt, bufs []interface{}) error {
+	f.mu.Lock()
+	f.record("GetOptionValues")
+	f.mu.Unlock()
+	for i, n := range ns {
+		if _, err := f.fakeBackend.ControlOption(h, n, ActionGetValue, bufs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestOptionValuesValueGetter(t *testing.T) {
+	want := map[string]interface{}{
+		"resolution": 300,
+		"mode":       "Color",
+		"tl-x":       0.0,
+		"tl-y":       0.0,
+		"br-x":       FixedToFloat(FloatToFixed(215.9)),
+		"br-y":       297.0,
+	}
+	f := batchFake{newFakeBackend()}
+	SetBackend(f)
+	if err := Init(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	h, err := Open("fake:0")
+	if err != nil {
+		Exit()
+		t.Fatal(err)
+	}
+	if err := Start(h); err != nil {
+		Exit()
+		t.Fatal(err)
+	}
+	got, err := OptionValues(h)
+	if err != nil {
+		t.Fatalf("OptionValues while acquiring: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("OptionValues = %v, want %v", got, want)
+	}
+	calls := f.called()
+	tail := calls[len(calls)-len(want)-1:]
+	if tail[0] != "GetOptionValues" || countCalls(f.fakeBackend, "GetOptionValues") != 1 {
+		t.Errorf("OptionValues did not read the values with one GetOptionValues: %v", tail)
+	}
+	Exit()
+
+	if err := getOptionValues(h, []SInt{1}, []interface{}{make([]SWord, 1)}); !isNotInitialized(err) {
+		t.Errorf("getOptionValues after Exit = %v, want ErrNotInitialized", err)
+	}
+}
+
+func isNotInitialized(err error) bool {
+	le, ok := err.(*LibError)
+	return ok && le.Err == ErrNotInitialized
+}
+
+func TestOptionValuesNonzeroBool(t *testing.T) {
+	f := newFakeBackend()
+	// Per the SANE standard any nonzero word is true, not only STRUE.
+	f.addOption(OptionDescriptor{Name: "lamp-switch", Type: TypeBool, Size: 4, Cap: SoftSelect | SoftDetect}, SWord(2))
+	f.addOption(OptionDescriptor{Name: "batch", Type: TypeBool, Size: 8, Cap: SoftSelect | SoftDetect}, SFALSE)
+	f.option("batch").words[1] = -1
+	h := setupFake(t, f)
+	defer Exit()
+
+	got, err := OptionValues(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := got["lamp-switch"]; v != true {
+		t.Errorf("lamp-switch = %v, want true", v)
+	}
+	if v := got["batch"]; !reflect.DeepEqual(v, []bool{false, true}) {
+		t.Errorf("batch = %v, want [false true]", v)
+	}
+}
+
+// writeOptionsFile writes text to a temporary file and returns its path.
+func writeOptionsFile(t *testing.T, text string) string {
+	t.Helper()
+	f, err := ioutil.TempFile("", "gosane-options")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(text); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestLoadOptionsFileComments(t *testing.T) {
+	f := newFakeBackend()
+	for _, name := range []SStringConst{"note", "label", "tag"} {
+		f.addOption(OptionDescriptor{Name: name, Type: TypeString, Size: 32, Cap: SoftSelect | SoftDetect}, "")
+	}
+	h := setupFake(t, f)
+	defer Exit()
+
+	path := writeOptionsFile(t, `# A scan job.
+mode = Gray	# trailing comment
+resolution = 150
+note = Tray#1
+label = "a # \"b\""  # quoted
+tag = x \# y
+`)
+	defer os.Remove(path)
+	if err := LoadOptionsFile(h, path); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[SStringConst]string{
+		NameScanMode: "Gray",
+		"note":       "Tray#1",
+		"label":      `a # "b"`,
+		"tag":        "x # y",
+	} {
+		if got := f.option(name).str; got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if r := f.option(NameScanResolution).words[0]; r != 150 {
+		t.Errorf("resolution = %d, want 150", r)
+	}
+}
+
+func TestLoadOptionsFileBadQuote(t *testing.T) {
+	h := setupFake(t, newFakeBackend())
+	defer Exit()
+
+	path := writeOptionsFile(t, "resolution = 150\nmode = \"Gray\n")
+	defer os.Remove(path)
+	err := LoadOptionsFile(h, path)
+	if err == nil || !strings.Contains(err.Error(), ":2: ") {
+		t.Errorf("LoadOptionsFile = %v, want an error on line 2", err)
+	}
+}